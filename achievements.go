@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Badge is an achievement a player can earn once
+type Badge struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// Badges awarded after a game
+var (
+	badgeFirstWin      = Badge{"first-win", "First Blood", "Won a game"}
+	badgeHundredGames  = Badge{"hundred-games", "Centurion", "Finished 100 games"}
+	badgeKnightMate    = Badge{"knight-promotion-mate", "Dark Horse", "Won with a final move promoting to a knight that gives check"}
+	badgeTenGameStreak = Badge{"win-streak-10", "Unstoppable", "Won 10 games in a row"}
+)
+
+var achievementBadges = []Badge{badgeFirstWin, badgeHundredGames, badgeKnightMate, badgeTenGameStreak}
+
+// Finished games waiting to be checked for achievements
+var achievementQueue = make(chan Game, 100)
+
+// Achievement is a badge awarded to a player, with the game that earned it
+type Achievement struct {
+	ID        string    `json:"-" bson:"_id"`
+	Player    string    `json:"player" bson:"player"`
+	Badge     string    `json:"badge" bson:"badge"`
+	Title     string    `json:"title" bson:"title"`
+	GameID    string    `json:"gameId" bson:"gameId"`
+	AwardedAt time.Time `json:"awardedAt" bson:"awardedAt"`
+}
+
+// Helper function to get the MongoDB collection of awarded achievements
+func getAchievements() *mongo.Collection {
+	return client.Database("chess").Collection("achievements")
+}
+
+// queueAchievements hands a finished game to the achievements worker without blocking the request
+func queueAchievements(game Game) {
+	select {
+	case achievementQueue <- game:
+	default:
+		log.Printf("Achievement queue full, skipping game %s", game.ID)
+	}
+}
+
+// runAchievements checks finished games for newly earned badges
+func runAchievements() {
+	for game := range achievementQueue {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		for _, player := range []string{game.Player1, game.Player2} {
+			if player == "" {
+				continue
+			}
+			if err := checkAchievements(ctx, game, player); err != nil {
+				log.Printf("Failed to check achievements of %s: %v", player, err)
+			}
+		}
+		cancel()
+	}
+}
+
+// Helper function to tell whether a player won a game
+func wonGame(game Game, player string) bool {
+	return (game.Result == "1-0" && player == game.Player1) || (game.Result == "0-1" && player == game.Player2)
+}
+
+// Helper function to get the filter matching a player's finished games
+func finishedGamesOf(player string) bson.M {
+	return bson.M{
+		"$or":    []bson.M{{"player1": player}, {"player2": player}},
+		"result": bson.M{"$exists": true},
+	}
+}
+
+// Helper function to tell whether a player's final move in a game promoted a
+// pawn to a knight that gives check. There is no move generator to confirm
+// mate, so this is taken together with the player winning the game.
+func knightPromotionCheck(game Game, player string) bool {
+	n := len(game.Moves)
+	if n == 0 || (n%2 == 1) != (player == game.Player1) {
+		return false
+	}
+	_, to, promotion, err := parseMove(game.Moves[n-1])
+	if err != nil || promotion != 'n' {
+		return false
+	}
+	board, err := replayMoves(game.Moves)
+	return err == nil && checksKing(board, to)
+}
+
+// checkAchievements awards the badges a player earned with a finished game
+func checkAchievements(ctx context.Context, game Game, player string) error {
+	if game.Player1 == game.Player2 {
+		return nil
+	}
+
+	var earned []Badge
+	if wonGame(game, player) {
+		earned = append(earned, badgeFirstWin)
+
+		if knightPromotionCheck(game, player) {
+			earned = append(earned, badgeKnightMate)
+		}
+
+		streak, err := hasWinStreak(ctx, player, 10)
+		if err != nil {
+			return err
+		}
+		if streak {
+			earned = append(earned, badgeTenGameStreak)
+		}
+	}
+
+	played, err := getCollection().CountDocuments(ctx, finishedGamesOf(player))
+	if err != nil {
+		return err
+	}
+	if played >= 100 {
+		earned = append(earned, badgeHundredGames)
+	}
+
+	for _, badge := range earned {
+		if err := awardBadge(ctx, player, badge, game); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper function to tell whether a player won each of their last n finished
+// games, in the order their results were recorded
+func hasWinStreak(ctx context.Context, player string, n int) (bool, error) {
+	opts := options.Find().SetSort(bson.M{"finishedAt": -1}).SetLimit(int64(n))
+	cursor, err := getCollection().Find(ctx, finishedGamesOf(player), opts)
+	if err != nil {
+		return false, err
+	}
+	var games []Game
+	if err := cursor.All(ctx, &games); err != nil {
+		return false, err
+	}
+	if len(games) < n {
+		return false, nil
+	}
+	for _, game := range games {
+		if !wonGame(game, player) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// awardBadge stores a badge for a player and announces it, unless they already have it
+func awardBadge(ctx context.Context, player string, badge Badge, game Game) error {
+	achievement := Achievement{
+		ID:        player + "/" + badge.ID,
+		Player:    player,
+		Badge:     badge.ID,
+		Title:     badge.Title,
+		GameID:    game.ID,
+		AwardedAt: time.Now(),
+	}
+	_, err := getAchievements().InsertOne(ctx, achievement)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Awarded %s to %s", badge.ID, player)
+	broadcast(ctx, gameTopic(game.ID), Message{Type: "achievement", Data: achievement})
+	messagePlayer(player, fmt.Sprintf("Achievement unlocked: %s! %s.%s", badge.Title, badge.Description, announcementLink(game.ID)), nil)
+	return nil
+}
+
+// Handler function to list the badges a player has earned
+func getPlayerAchievements(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	player := mux.Vars(r)["id"]
+	opts := options.Find().SetSort(bson.M{"awardedAt": 1})
+	cursor, err := getAchievements().Find(r.Context(), bson.M{"player": player}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	achievements := []Achievement{}
+	if err := cursor.All(r.Context(), &achievements); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"player":       player,
+		"achievements": achievements,
+		"badges":       achievementBadges,
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestKnightPromotionCheck(t *testing.T) {
+	checking := []string{"h2h4", "g7g5", "h4g5", "h7h6", "g5h6", "e7e6", "h6h7", "e8e7", "h7g8n"}
+	quiet := []string{"h2h4", "g7g5", "h4g5", "h7h6", "g5h6", "g8f6", "h6h7", "a7a6", "h7g8n"}
+	queen := []string{"h2h4", "g7g5", "h4g5", "h7h6", "g5h6", "e7e6", "h6h7", "e8e7", "h7g8q"}
+
+	tests := []struct {
+		name   string
+		moves  []string
+		player string
+		want   bool
+	}{
+		{"knight promotion gives check", checking, "white", true},
+		{"knight promotion without check", quiet, "white", false},
+		{"queen promotion", queen, "white", false},
+		{"not the player's final move", checking, "black", false},
+		{"no moves", nil, "white", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := Game{Player1: "white", Player2: "black", Moves: tt.moves, Result: "1-0"}
+			if got := knightPromotionCheck(game, tt.player); got != tt.want {
+				t.Errorf("knightPromotionCheck(%v, %s) = %v, want %v", tt.moves, tt.player, got, tt.want)
+			}
+		})
+	}
+}
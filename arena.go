@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// How often running arenas are checked for players waiting for a game
+const arenaPairingInterval = 5 * time.Second
+
+// Longest arena that can be created, in minutes
+const maxArenaMinutes = 24 * 60
+
+// Arena is a tournament where players are paired continuously until it ends
+type Arena struct {
+	ID        string        `json:"id,omitempty" bson:"_id,omitempty"`
+	Name      string        `json:"name,omitempty" bson:"name,omitempty"`
+	StartsAt  time.Time     `json:"startsAt" bson:"startsAt"`
+	EndsAt    time.Time     `json:"endsAt" bson:"endsAt"`
+	CreatedAt time.Time     `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	Players   []ArenaPlayer `json:"players" bson:"players"`
+}
+
+// ArenaPlayer is a participant's standing in an arena. Wins are worth 2
+// points and draws 1; after two wins in a row a player is on fire and
+// scores double until they fail to win.
+type ArenaPlayer struct {
+	Name         string `json:"name" bson:"name"`
+	Score        int    `json:"score" bson:"score"`
+	Games        int    `json:"games" bson:"games"`
+	Streak       int    `json:"streak" bson:"streak"`
+	OnFire       bool   `json:"onFire" bson:"onFire"`
+	Withdrawn    bool   `json:"withdrawn,omitempty" bson:"withdrawn,omitempty"`
+	WhiteGames   int    `json:"-" bson:"whiteGames"`
+	LastOpponent string `json:"-" bson:"lastOpponent,omitempty"`
+}
+
+// ArenaView is an arena with its leaderboard
+type ArenaView struct {
+	Arena
+	Status      string        `json:"status"`
+	Leaderboard []ArenaPlayer `json:"leaderboard"`
+}
+
+// Serialises changes to arena standings, which are read, changed and written back whole
+var arenaMu sync.Mutex
+
+// Helper function to get the MongoDB collection of arenas
+func getArenas() *mongo.Collection {
+	return client.Database("chess").Collection("arenas")
+}
+
+// Helper function to get the topic on which an arena's leaderboard is broadcast
+func arenaTopic(id string) string {
+	return "arena:" + id
+}
+
+// Helper function to find an arena by its hex ID
+func findArena(ctx context.Context, hexId string) (Arena, error) {
+	var arena Arena
+	id, err := primitive.ObjectIDFromHex(hexId)
+	if err != nil {
+		return arena, err
+	}
+	err = getArenas().FindOne(ctx, bson.M{"_id": id}).Decode(&arena)
+	return arena, err
+}
+
+// Helper function to store an arena's players
+func saveArenaPlayers(ctx context.Context, arena Arena) error {
+	id, err := primitive.ObjectIDFromHex(arena.ID)
+	if err != nil {
+		return err
+	}
+	_, err = getArenas().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"players": arena.Players}})
+	return err
+}
+
+// Helper function to get the index of a player in an arena, -1 if they have not joined
+func arenaPlayerIndex(arena Arena, name string) int {
+	for i, player := range arena.Players {
+		if player.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Helper function to build the view of an arena with its leaderboard
+func arenaView(arena Arena) ArenaView {
+	view := ArenaView{Arena: arena, Status: "running"}
+	now := time.Now()
+	if now.Before(arena.StartsAt) {
+		view.Status = "created"
+	} else if !now.Before(arena.EndsAt) {
+		view.Status = "finished"
+	}
+
+	view.Leaderboard = append([]ArenaPlayer{}, arena.Players...)
+	sort.SliceStable(view.Leaderboard, func(i, j int) bool {
+		a, b := view.Leaderboard[i], view.Leaderboard[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Games < b.Games
+	})
+	return view
+}
+
+// Helper function to push an arena's leaderboard to spectators
+func publishArena(ctx context.Context, arena Arena) {
+	broadcast(ctx, arenaTopic(arena.ID), Message{Type: "arena", Data: arenaView(arena)})
+}
+
+// Handler function to create an arena
+func createArena(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	var req struct {
+		Name     string    `json:"name"`
+		StartsAt time.Time `json:"startsAt"`
+		Minutes  int       `json:"minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if req.Minutes <= 0 || req.Minutes > maxArenaMinutes {
+		http.Error(w, "Invalid arena length", http.StatusBadRequest)
+		return
+	}
+
+	// Start right away unless a start time is given
+	if req.StartsAt.IsZero() {
+		req.StartsAt = time.Now()
+	}
+	arena := Arena{
+		Name:      req.Name,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.StartsAt.Add(time.Duration(req.Minutes) * time.Minute),
+		CreatedAt: time.Now(),
+		Players:   []ArenaPlayer{},
+	}
+
+	result, err := getArenas().InsertOne(r.Context(), arena)
+	if err != nil {
+		http.Error(w, "Failed to insert arena into database", http.StatusInternalServerError)
+		return
+	}
+	arena.ID = result.InsertedID.(primitive.ObjectID).Hex()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(arenaView(arena))
+}
+
+// Handler function to get an arena with its leaderboard
+func getArena(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	arena, err := findArena(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Arena not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(arenaView(arena))
+}
+
+// Helper function to decode the player named in a join or withdraw request
+func decodeArenaPlayer(r *http.Request) (string, bool) {
+	var req struct {
+		Player string `json:"player"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Player == "" {
+		return "", false
+	}
+	return req.Player, true
+}
+
+// Handler function to join an arena, or rejoin after withdrawing
+func joinArena(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	player, ok := decodeArenaPlayer(r)
+	if !ok {
+		http.Error(w, "Missing player", http.StatusBadRequest)
+		return
+	}
+
+	arenaMu.Lock()
+	defer arenaMu.Unlock()
+
+	arena, err := findArena(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Arena not found", http.StatusNotFound)
+		return
+	}
+	if !time.Now().Before(arena.EndsAt) {
+		http.Error(w, "Arena is over", http.StatusConflict)
+		return
+	}
+
+	if i := arenaPlayerIndex(arena, player); i >= 0 {
+		arena.Players[i].Withdrawn = false
+	} else {
+		arena.Players = append(arena.Players, ArenaPlayer{Name: player})
+	}
+	if err := saveArenaPlayers(r.Context(), arena); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	publishArena(r.Context(), arena)
+	json.NewEncoder(w).Encode(arenaView(arena))
+}
+
+// Handler function to stop being paired in an arena, keeping the score so far
+func withdrawArena(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	player, ok := decodeArenaPlayer(r)
+	if !ok {
+		http.Error(w, "Missing player", http.StatusBadRequest)
+		return
+	}
+
+	arenaMu.Lock()
+	defer arenaMu.Unlock()
+
+	arena, err := findArena(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Arena not found", http.StatusNotFound)
+		return
+	}
+	i := arenaPlayerIndex(arena, player)
+	if i < 0 {
+		http.Error(w, "Player has not joined the arena", http.StatusNotFound)
+		return
+	}
+
+	arena.Players[i].Withdrawn = true
+	if err := saveArenaPlayers(r.Context(), arena); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	publishArena(r.Context(), arena)
+	json.NewEncoder(w).Encode(arenaView(arena))
+}
+
+// Handler function to follow an arena's leaderboard live over a WebSocket
+func watchArena(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+	id := mux.Vars(r)["id"]
+
+	arena, err := findArena(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Arena not found", http.StatusNotFound)
+		return
+	}
+
+	subscribe(w, r, arenaTopic(id), &Message{Type: "arena", Data: arenaView(arena)}, nil)
+}
+
+// Helper function to update a player's standing with the outcome of a game: 1 win, 0 draw, -1 loss
+func scoreArenaResult(player *ArenaPlayer, outcome int) {
+	player.Games++
+
+	points := outcome + 1
+	if player.OnFire {
+		points *= 2
+	}
+	player.Score += points
+
+	if outcome > 0 {
+		player.Streak++
+		player.OnFire = player.Streak >= 2
+	} else {
+		player.Streak = 0
+		player.OnFire = false
+	}
+}
+
+// scoreArenaGame adds the result of a finished arena game to the standings and pairs the players again
+func scoreArenaGame(game Game) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	arenaMu.Lock()
+	defer arenaMu.Unlock()
+
+	arena, err := findArena(ctx, game.ArenaID)
+	if err != nil {
+		log.Printf("Failed to load arena %s: %v", game.ArenaID, err)
+		return
+	}
+
+	white, black := 0, 0
+	switch game.Result {
+	case "1-0":
+		white, black = 1, -1
+	case "0-1":
+		white, black = -1, 1
+	}
+	if i := arenaPlayerIndex(arena, game.Player1); i >= 0 {
+		scoreArenaResult(&arena.Players[i], white)
+	}
+	if i := arenaPlayerIndex(arena, game.Player2); i >= 0 {
+		scoreArenaResult(&arena.Players[i], black)
+	}
+
+	if err := saveArenaPlayers(ctx, arena); err != nil {
+		log.Printf("Failed to save arena %s: %v", arena.ID, err)
+		return
+	}
+	publishArena(ctx, arena)
+
+	// Both players are free again, pair them without waiting for the next round
+	if err := pairArena(ctx, arena); err != nil {
+		log.Printf("Failed to pair arena %s: %v", arena.ID, err)
+	}
+}
+
+// runArenaPairing periodically pairs waiting players in every running arena
+func runArenaPairing() {
+	ticker := time.NewTicker(arenaPairingInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), arenaPairingInterval)
+		now := time.Now()
+		cursor, err := getArenas().Find(ctx, bson.M{"startsAt": bson.M{"$lte": now}, "endsAt": bson.M{"$gt": now}})
+		if err != nil {
+			log.Printf("Failed to find running arenas: %v", err)
+			cancel()
+			continue
+		}
+		var arenas []Arena
+		if err := cursor.All(ctx, &arenas); err != nil {
+			log.Printf("Failed to load running arenas: %v", err)
+		}
+
+		for _, arena := range arenas {
+			arenaMu.Lock()
+			// Reload under the lock, standings may have changed since the query
+			if current, err := findArena(ctx, arena.ID); err == nil {
+				if err := pairArena(ctx, current); err != nil {
+					log.Printf("Failed to pair arena %s: %v", arena.ID, err)
+				}
+			}
+			arenaMu.Unlock()
+		}
+		cancel()
+	}
+}
+
+// pairArena starts games between players who are not currently playing,
+// pairing players with similar scores and avoiding immediate rematches.
+// Callers must hold arenaMu.
+func pairArena(ctx context.Context, arena Arena) error {
+	now := time.Now()
+	if now.Before(arena.StartsAt) || !now.Before(arena.EndsAt) {
+		return nil
+	}
+
+	// Players in an unfinished game are busy
+	cursor, err := getCollection().Find(ctx, bson.M{
+		"arenaId": arena.ID,
+		"$or":     []bson.M{{"result": bson.M{"$exists": false}}, {"result": ""}},
+	})
+	if err != nil {
+		return err
+	}
+	var ongoing []Game
+	if err := cursor.All(ctx, &ongoing); err != nil {
+		return err
+	}
+	busy := make(map[string]bool)
+	for _, game := range ongoing {
+		busy[game.Player1] = true
+		busy[game.Player2] = true
+	}
+
+	var waiting []int
+	for i, player := range arena.Players {
+		if !player.Withdrawn && !busy[player.Name] {
+			waiting = append(waiting, i)
+		}
+	}
+	if len(waiting) < 2 {
+		return nil
+	}
+	sort.SliceStable(waiting, func(a, b int) bool {
+		return arena.Players[waiting[a]].Score > arena.Players[waiting[b]].Score
+	})
+
+	for len(waiting) >= 2 {
+		first := waiting[0]
+		// Take the closest opponent by score that was not just played, if there is one
+		pick := 1
+		for j := 1; j < len(waiting); j++ {
+			if arena.Players[waiting[j]].Name != arena.Players[first].LastOpponent {
+				pick = j
+				break
+			}
+		}
+		second := waiting[pick]
+		waiting = append(waiting[1:pick], waiting[pick+1:]...)
+
+		// Whoever has had white less often gets white
+		white, black := &arena.Players[first], &arena.Players[second]
+		if white.WhiteGames > black.WhiteGames {
+			white, black = black, white
+		}
+
+		game := Game{GameName: arena.Name, Player1: white.Name, Player2: black.Name, ArenaID: arena.ID}
+		if err := insertGame(ctx, &game); err != nil {
+			return err
+		}
+		white.WhiteGames++
+		white.LastOpponent = black.Name
+		black.LastOpponent = white.Name
+		broadcast(ctx, arenaTopic(arena.ID), Message{Type: "pairing", Data: game})
+	}
+
+	if err := saveArenaPlayers(ctx, arena); err != nil {
+		return err
+	}
+	publishArena(ctx, arena)
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestScoreArenaResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []int
+		want     ArenaPlayer
+	}{
+		{
+			name:     "a win scores 2 and a draw 1",
+			outcomes: []int{1, 0},
+			want:     ArenaPlayer{Score: 3, Games: 2},
+		},
+		{
+			name:     "a loss scores nothing",
+			outcomes: []int{-1},
+			want:     ArenaPlayer{Score: 0, Games: 1},
+		},
+		{
+			name:     "two wins in a row put the player on fire",
+			outcomes: []int{1, 1},
+			want:     ArenaPlayer{Score: 4, Games: 2, Streak: 2, OnFire: true},
+		},
+		{
+			name:     "wins on fire score double",
+			outcomes: []int{1, 1, 1},
+			want:     ArenaPlayer{Score: 8, Games: 3, Streak: 3, OnFire: true},
+		},
+		{
+			name:     "a draw on fire scores double and ends the streak",
+			outcomes: []int{1, 1, 0, 1},
+			want:     ArenaPlayer{Score: 8, Games: 4, Streak: 1},
+		},
+		{
+			name:     "a loss on fire ends the streak",
+			outcomes: []int{1, 1, -1, 1},
+			want:     ArenaPlayer{Score: 6, Games: 4, Streak: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var player ArenaPlayer
+			for _, outcome := range tt.outcomes {
+				scoreArenaResult(&player, outcome)
+			}
+			if player != tt.want {
+				t.Errorf("after %v got %+v, want %+v", tt.outcomes, player, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Who a blindfold game hides the board from
+const (
+	blindfoldWhite = "white"
+	blindfoldBlack = "black"
+	blindfoldBoth  = "both"
+)
+
+// Reveal is the final position of a game, shown once it has ended
+type Reveal struct {
+	GameID   string   `json:"gameId"`
+	Moves    []string `json:"moves"`
+	Result   string   `json:"result"`
+	FEN      string   `json:"fen"`
+	ImageURL string   `json:"imageUrl"`
+}
+
+// Helper function to check a game's blindfold option
+func validBlindfold(blindfold string) bool {
+	switch blindfold {
+	case "", blindfoldWhite, blindfoldBlack, blindfoldBoth:
+		return true
+	}
+	return false
+}
+
+// Helper function to tell whether a game's board is withheld. Requests are not
+// tied to a player, so the API withholds it from everyone until the game ends.
+func boardHidden(game Game) bool {
+	return game.Blindfold != "" && game.Result == ""
+}
+
+// Helper function to tell whether a game's board is withheld from one of its players
+func boardHiddenFrom(game Game, player string) bool {
+	if !boardHidden(game) {
+		return false
+	}
+	switch game.Blindfold {
+	case blindfoldWhite:
+		return player == game.Player1
+	case blindfoldBlack:
+		return player == game.Player2
+	}
+	return true
+}
+
+// Handler function to reveal the final position of a game once it has ended
+func revealGame(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+	id := mux.Vars(r)["id"]
+
+	game, err := findGame(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if game.Result == "" {
+		http.Error(w, "Game is still in progress", http.StatusConflict)
+		return
+	}
+
+	board, err := replayMoves(game.Moves)
+	if err != nil {
+		log.Printf("Showing partial position for game %s: %v", id, err)
+	}
+
+	json.NewEncoder(w).Encode(Reveal{
+		GameID:   id,
+		Moves:    game.Moves,
+		Result:   game.Result,
+		FEN:      board.FEN(),
+		ImageURL: publicURL(r) + apiV1Prefix + "/games/" + id + "/image.png",
+	})
+}
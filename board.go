@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Board is the position reached by replaying a game's moves. Moves are
+// applied as coordinate moves (e2e4, e7e8q) without checking legality,
+// mirroring the API which stores moves as submitted.
+type Board struct {
+	Squares     [64]byte // a1 = 0, h8 = 63; "PNBRQK" for white, lowercase for black, 0 if empty
+	WhiteToMove bool
+	Castling    string // subset of "KQkq"
+	EnPassant   int    // square a pawn can capture onto en passant, -1 if none
+	Halfmoves   int
+	Fullmoves   int
+	LastMove    [2]int // from and to squares of the last move, -1 if none
+}
+
+// Helper function to create a board with the standard starting position
+func newBoard() *Board {
+	b := &Board{WhiteToMove: true, Castling: "KQkq", EnPassant: -1, Fullmoves: 1, LastMove: [2]int{-1, -1}}
+	back := "RNBQKBNR"
+	for file := 0; file < 8; file++ {
+		b.Squares[file] = back[file]
+		b.Squares[8+file] = 'P'
+		b.Squares[48+file] = 'p'
+		b.Squares[56+file] = strings.ToLower(back)[file]
+	}
+	return b
+}
+
+// replayMoves builds the board after playing the given moves from the starting
+// position. If a move cannot be applied, the board reached before it is
+// returned along with the error.
+func replayMoves(moves []string) (*Board, error) {
+	b := newBoard()
+	for i, move := range moves {
+		if err := b.applyMove(move); err != nil {
+			return b, fmt.Errorf("move %d (%q): %v", i+1, move, err)
+		}
+	}
+	return b, nil
+}
+
+// Helper function to parse a square name such as "e4"
+func parseSquare(s string) (int, bool) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return 0, false
+	}
+	return int(s[1]-'1')*8 + int(s[0]-'a'), true
+}
+
+// Helper function to get the name of a square
+func squareName(sq int) string {
+	return string([]byte{byte('a' + sq%8), byte('1' + sq/8)})
+}
+
+// Helper function to parse a coordinate move into its squares and promotion piece
+func parseMove(move string) (from, to int, promotion byte, err error) {
+	m := strings.NewReplacer("-", "", "x", "", "=", "", "+", "", "#", "").Replace(move)
+	if len(m) != 4 && len(m) != 5 {
+		return 0, 0, 0, fmt.Errorf("not a coordinate move")
+	}
+	from, okFrom := parseSquare(m[0:2])
+	to, okTo := parseSquare(m[2:4])
+	if !okFrom || !okTo || from == to {
+		return 0, 0, 0, fmt.Errorf("not a coordinate move")
+	}
+	if len(m) == 5 {
+		promotion = strings.ToLower(m[4:])[0]
+		if !strings.ContainsRune("nbrq", rune(promotion)) {
+			return 0, 0, 0, fmt.Errorf("invalid promotion piece")
+		}
+	}
+	return from, to, promotion, nil
+}
+
+// Helper function to report whether a piece belongs to white
+func isWhite(piece byte) bool {
+	return piece >= 'A' && piece <= 'Z'
+}
+
+// Helper function to tell whether a king move is castling: from its home square
+// to the c or g file of the same rank
+func isCastling(king byte, from, to int) bool {
+	home := 4
+	if !isWhite(king) {
+		home = 60
+	}
+	return from == home && (to == home-2 || to == home+2)
+}
+
+// applyMove plays a single coordinate move on the board
+func (b *Board) applyMove(move string) error {
+	from, to, promotion, err := parseMove(move)
+	if err != nil {
+		return err
+	}
+	piece := b.Squares[from]
+	if piece == 0 {
+		return fmt.Errorf("no piece on %s", squareName(from))
+	}
+	if isWhite(piece) != b.WhiteToMove {
+		return fmt.Errorf("piece on %s does not belong to the side to move", squareName(from))
+	}
+
+	captured := b.Squares[to]
+	if captured != 0 && isWhite(captured) == b.WhiteToMove {
+		return fmt.Errorf("%s is occupied by a piece of the side to move", squareName(to))
+	}
+	kind := strings.ToLower(string(piece))[0]
+
+	switch kind {
+	case 'k':
+		// Castling moves the king two files and brings the rook alongside
+		if d := to%8 - from%8; d == 2 || d == -2 {
+			if !isCastling(piece, from, to) {
+				return fmt.Errorf("king cannot move from %s to %s", squareName(from), squareName(to))
+			}
+			if d == 2 {
+				b.Squares[to-1], b.Squares[to+1] = b.Squares[to+1], 0
+			} else {
+				b.Squares[to+1], b.Squares[to-2] = b.Squares[to-2], 0
+			}
+		}
+	case 'p':
+		// A diagonal pawn move onto the en passant square removes the passed pawn
+		if to == b.EnPassant && from%8 != to%8 && captured == 0 {
+			if b.WhiteToMove {
+				b.Squares[to-8] = 0
+			} else {
+				b.Squares[to+8] = 0
+			}
+			captured = 'p'
+		}
+		if to/8 == 0 || to/8 == 7 {
+			if promotion == 0 {
+				promotion = 'q'
+			}
+			piece = promotion
+			if b.WhiteToMove {
+				piece = strings.ToUpper(string(promotion))[0]
+			}
+		}
+	}
+
+	b.Squares[to] = piece
+	b.Squares[from] = 0
+
+	// Moving the king or a rook, or capturing a rook, loses castling rights
+	for sq, right := range map[int]string{4: "KQ", 60: "kq", 0: "Q", 7: "K", 56: "q", 63: "k"} {
+		if from == sq || to == sq {
+			for _, r := range right {
+				b.Castling = strings.Replace(b.Castling, string(r), "", 1)
+			}
+		}
+	}
+
+	b.EnPassant = -1
+	if kind == 'p' && (to-from == 16 || from-to == 16) {
+		b.EnPassant = (from + to) / 2
+	}
+
+	if kind == 'p' || captured != 0 {
+		b.Halfmoves = 0
+	} else {
+		b.Halfmoves++
+	}
+	if !b.WhiteToMove {
+		b.Fullmoves++
+	}
+	b.WhiteToMove = !b.WhiteToMove
+	b.LastMove = [2]int{from, to}
+	return nil
+}
+
+// FEN returns the position in Forsyth-Edwards Notation
+func (b *Board) FEN() string {
+	var sb strings.Builder
+	for rank := 7; rank >= 0; rank-- {
+		empty := 0
+		for file := 0; file < 8; file++ {
+			piece := b.Squares[rank*8+file]
+			if piece == 0 {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			sb.WriteByte(piece)
+		}
+		if empty > 0 {
+			sb.WriteString(strconv.Itoa(empty))
+		}
+		if rank > 0 {
+			sb.WriteByte('/')
+		}
+	}
+
+	side := "w"
+	if !b.WhiteToMove {
+		side = "b"
+	}
+	castling := b.Castling
+	if castling == "" {
+		castling = "-"
+	}
+	enPassant := "-"
+	if b.EnPassant >= 0 {
+		enPassant = squareName(b.EnPassant)
+	}
+	return fmt.Sprintf("%s %s %s %s %d %d", sb.String(), side, castling, enPassant, b.Halfmoves, b.Fullmoves)
+}
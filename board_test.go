@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+func TestReplayMoves(t *testing.T) {
+	tests := []struct {
+		name    string
+		moves   []string
+		fen     string
+		wantErr bool
+	}{
+		{
+			name:  "start position",
+			moves: nil,
+			fen:   "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		},
+		{
+			name:  "double pawn push sets en passant square",
+			moves: []string{"e2e4"},
+			fen:   "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		},
+		{
+			name:  "white castles kingside",
+			moves: []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1c4", "g8f6", "e1g1"},
+			fen:   "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQ1RK1 b kq - 5 4",
+		},
+		{
+			name:  "black castles queenside",
+			moves: []string{"d2d4", "d7d5", "b1c3", "b8c6", "c1f4", "c8f5", "d1d2", "d8d7", "a2a3", "e8c8"},
+			fen:   "2kr1bnr/pppqpppp/2n5/3p1b2/3P1B2/P1N5/1PPQPPPP/R3KBNR w KQ - 1 6",
+		},
+		{
+			name:  "en passant removes the passed pawn",
+			moves: []string{"e2e4", "a7a6", "e4e5", "d7d5", "e5d6"},
+			fen:   "rnbqkbnr/1pp1pppp/p2P4/8/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 3",
+		},
+		{
+			name:  "promotion defaults to a queen",
+			moves: []string{"h2h4", "g7g5", "h4g5", "h7h6", "g5h6", "g8f6", "h6h7", "a7a6", "h7g8"},
+			fen:   "rnbqkbQr/1ppppp2/p4n2/8/8/8/PPPPPPP1/RNBQKBNR b KQkq - 0 5",
+		},
+		{
+			name:  "underpromotion to a knight",
+			moves: []string{"h2h4", "g7g5", "h4g5", "h7h6", "g5h6", "g8f6", "h6h7", "a7a6", "h7g8n"},
+			fen:   "rnbqkbNr/1ppppp2/p4n2/8/8/8/PPPPPPP1/RNBQKBNR b KQkq - 0 5",
+		},
+		{
+			name:    "king two files towards the a-file edge is not castling",
+			moves:   []string{"e2e4", "e7e5", "e1c1", "a7a6", "c1a1"},
+			wantErr: true,
+		},
+		{
+			name:    "king two files towards the h-file edge is not castling",
+			moves:   []string{"e2e4", "e7e5", "a2a3", "f8c5", "a3a4", "e8f8", "a4a5", "f8h8"},
+			wantErr: true,
+		},
+		{
+			name:    "king away from its home square can't castle",
+			moves:   []string{"e2e4", "e7e5", "e1e2", "a7a6", "e2g2"},
+			wantErr: true,
+		},
+		{
+			name:    "moving the opponent's piece",
+			moves:   []string{"e7e5"},
+			wantErr: true,
+		},
+		{
+			name:    "capturing a piece of your own side",
+			moves:   []string{"a1a2"},
+			wantErr: true,
+		},
+		{
+			name:    "moving a piece onto its own square",
+			moves:   []string{"d1d1"},
+			wantErr: true,
+		},
+		{
+			name:    "moving from an empty square",
+			moves:   []string{"e3e4"},
+			wantErr: true,
+		},
+		{
+			name:    "not a coordinate move",
+			moves:   []string{"Nf3"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board, err := replayMoves(tt.moves)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("replayMoves(%v) = %s, want an error", tt.moves, board.FEN())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("replayMoves(%v) failed: %v", tt.moves, err)
+			}
+			if got := board.FEN(); got != tt.fen {
+				t.Errorf("replayMoves(%v) = %s, want %s", tt.moves, got, tt.fen)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+)
+
+const discordAPI = "https://discord.com/api/v10"
+
+// Interaction and response types used by the Discord interactions endpoint
+const (
+	discordPing               = 1
+	discordApplicationCommand = 2
+	discordPong               = 1
+	discordChannelMessage     = 4
+	discordEphemeral          = 1 << 6
+	discordUserOption         = 6
+	discordChatInputCommand   = 1
+)
+
+// Largest interaction payload the endpoint will read
+const discordMaxInteractionPayload = 1 << 20
+
+var discordClient = &http.Client{Timeout: 10 * time.Second}
+
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// discordInteraction is the subset of an incoming interaction the bot uses
+type discordInteraction struct {
+	Type int `json:"type"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string      `json:"name"`
+			Type  int         `json:"type"`
+			Value interface{} `json:"value"`
+		} `json:"options"`
+		Resolved struct {
+			Users map[string]discordUser `json:"users"`
+		} `json:"resolved"`
+	} `json:"data"`
+	// Member is set for interactions in a server, User for direct messages
+	Member *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+}
+
+// Helper function to report whether game announcements to Discord are configured
+func discordEnabled() bool {
+	return os.Getenv("DISCORD_BOT_TOKEN") != "" && os.Getenv("DISCORD_CHANNEL_ID") != ""
+}
+
+// initDiscord registers the bot's slash commands when DISCORD_APPLICATION_ID is set
+func initDiscord() {
+	if os.Getenv("DISCORD_BOT_TOKEN") == "" || os.Getenv("DISCORD_APPLICATION_ID") == "" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := registerDiscordCommands(ctx); err != nil {
+			log.Printf("Failed to register Discord commands: %v", err)
+		}
+	}()
+}
+
+// Helper function to call the Discord REST API as the bot
+func discordRequest(ctx context.Context, method, path, contentType string, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, method, discordAPI+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+os.Getenv("DISCORD_BOT_TOKEN"))
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := discordClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("discord returned status %d: %s", resp.StatusCode, detail)
+	}
+	return nil
+}
+
+// Helper function to register the /challenge slash command
+func registerDiscordCommands(ctx context.Context) error {
+	commands := []map[string]interface{}{{
+		"name":        "challenge",
+		"type":        discordChatInputCommand,
+		"description": "Challenge someone to a game of chess",
+		"options": []map[string]interface{}{{
+			"name":        "opponent",
+			"type":        discordUserOption,
+			"description": "Who to play against",
+			"required":    true,
+		}},
+	}}
+	body, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+	path := "/applications/" + os.Getenv("DISCORD_APPLICATION_ID") + "/commands"
+	return discordRequest(ctx, http.MethodPut, path, "application/json", bytes.NewReader(body))
+}
+
+// postDiscordMessage posts a message, with an optional PNG image, to the configured channel in the background
+func postDiscordMessage(content string, image []byte) {
+	if !discordEnabled() {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		payload := map[string]interface{}{
+			"content": content,
+			// Player names are user input, never let them ping anyone
+			"allowed_mentions": map[string][]string{"parse": {}},
+		}
+		if image != nil {
+			payload["attachments"] = []map[string]interface{}{{"id": 0, "filename": "board.png"}}
+		}
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Failed to encode Discord message: %v", err)
+			return
+		}
+
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("payload_json", string(payloadJSON))
+		if image != nil {
+			part, err := form.CreateFormFile("files[0]", "board.png")
+			if err != nil {
+				log.Printf("Failed to attach board image: %v", err)
+				return
+			}
+			part.Write(image)
+		}
+		form.Close()
+
+		path := "/channels/" + os.Getenv("DISCORD_CHANNEL_ID") + "/messages"
+		if err := discordRequest(ctx, http.MethodPost, path, form.FormDataContentType(), &body); err != nil {
+			log.Printf("Failed to post Discord message: %v", err)
+		}
+	}()
+}
+
+// Helper function to get a link to a game for announcements, empty if PUBLIC_URL is not set
+func announcementLink(id string) string {
+	base := os.Getenv("PUBLIC_URL")
+	if base == "" {
+		return ""
+	}
+	return "\n" + gameURL(base, id)
+}
+
+// announceGameStart posts a new game to Discord
+func announceGameStart(game Game) {
+	postDiscordMessage(fmt.Sprintf("New game **%s**: %s vs %s%s",
+		gameTitle(game), orUnknown(game.Player1), orUnknown(game.Player2), announcementLink(game.ID)), nil)
+}
+
+// announceGameFinish posts the result and final position of a game to Discord
+func announceGameFinish(game Game) {
+	if !discordEnabled() {
+		return
+	}
+
+	postDiscordMessage(fmt.Sprintf("**%s** finished: %s %s %s%s",
+		gameTitle(game), orUnknown(game.Player1), game.Result, orUnknown(game.Player2), announcementLink(game.ID)), gameBoardPNG(game))
+}
+
+// Helper function to check an interaction was signed by Discord
+func verifyDiscordSignature(r *http.Request, body []byte) bool {
+	publicKey, err := hex.DecodeString(os.Getenv("DISCORD_PUBLIC_KEY"))
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil {
+		return false
+	}
+	message := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	return ed25519.Verify(publicKey, message, signature)
+}
+
+// Helper function to answer an interaction with a message
+func respondDiscord(w http.ResponseWriter, content string, flags int, mentions []string) {
+	if mentions == nil {
+		mentions = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type": discordChannelMessage,
+		"data": map[string]interface{}{
+			"content":          content,
+			"flags":            flags,
+			"allowed_mentions": map[string]interface{}{"parse": []string{}, "users": mentions},
+		},
+	})
+}
+
+// Handler function for the Discord interactions endpoint, serving the /challenge command
+func discordInteractions(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	if os.Getenv("DISCORD_PUBLIC_KEY") == "" {
+		http.Error(w, "Discord integration not configured", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, discordMaxInteractionPayload))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if !verifyDiscordSignature(r, body) {
+		http.Error(w, "Invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case interaction.Type == discordPing:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"type": discordPong})
+	case interaction.Type == discordApplicationCommand && interaction.Data.Name == "challenge":
+		discordChallenge(w, r, interaction)
+	default:
+		http.Error(w, "Unsupported interaction", http.StatusBadRequest)
+	}
+}
+
+// Helper function to create a game between the user running /challenge and their opponent
+func discordChallenge(w http.ResponseWriter, r *http.Request, interaction discordInteraction) {
+	var challenger discordUser
+	if interaction.Member != nil {
+		challenger = interaction.Member.User
+	} else if interaction.User != nil {
+		challenger = *interaction.User
+	}
+
+	var opponent discordUser
+	for _, option := range interaction.Data.Options {
+		if id, ok := option.Value.(string); ok && option.Name == "opponent" {
+			opponent = interaction.Data.Resolved.Users[id]
+			opponent.ID = id
+		}
+	}
+
+	if opponent.ID == "" || opponent.Username == "" {
+		respondDiscord(w, "Pick someone to challenge.", discordEphemeral, nil)
+		return
+	}
+	if opponent.ID == challenger.ID {
+		respondDiscord(w, "You can't challenge yourself.", discordEphemeral, nil)
+		return
+	}
+
+	game := Game{
+		GameName: challenger.Username + " vs " + opponent.Username,
+		Player1:  challenger.Username,
+		Player2:  opponent.Username,
+	}
+	if err := insertGame(r.Context(), &game); err != nil {
+		log.Printf("Failed to create challenge game: %v", err)
+		respondDiscord(w, "Couldn't create the game, try again later.", discordEphemeral, nil)
+		return
+	}
+
+	content := fmt.Sprintf("<@%s> challenges <@%s> to a game of chess!", challenger.ID, opponent.ID)
+	if link := announcementLink(game.ID); link != "" {
+		content += link
+	} else {
+		content += "\nGame ID: " + game.ID
+	}
+	respondDiscord(w, content, 0, []string{challenger.ID, opponent.ID})
+}
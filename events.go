@@ -0,0 +1,45 @@
+package main
+
+import "context"
+
+// gameCreated is called after a new game has been stored
+func gameCreated(game Game) {
+	// Simuls and arenas create many games, don't announce each one
+	if game.SimulID == "" && game.ArenaID == "" {
+		announceGameStart(game)
+	}
+}
+
+// gameUpdated is called after a game has been changed, with its state before and after the change
+func gameUpdated(ctx context.Context, previous, game Game) {
+	// Push the new state to clients watching the game
+	publishGame(ctx, game)
+	if game.SimulID != "" {
+		publishSimul(ctx, game.SimulID)
+	}
+
+	if previous.Result == "" && game.Result != "" {
+		gameFinished(game)
+		return
+	}
+
+	// Let the player whose turn it now is know
+	if game.Result == "" && len(game.Moves) > len(previous.Moves) {
+		notifyTurn(game)
+	}
+}
+
+// gameFinished is called once, when a result is first recorded for a game
+func gameFinished(game Game) {
+	announceGameFinish(game)
+	if game.Rated {
+		updateRatings(game)
+	}
+	if game.ArenaID != "" {
+		scoreArenaGame(game)
+	}
+	// Vote chess games are played by teams, not by the named players
+	if game.VoteChessID == "" {
+		queueAchievements(game)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Handler function to start a new unrated game from the position after a ply
+// of an existing game, to try out a different line from there
+func forkGame(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+	id := mux.Vars(r)["id"]
+
+	// Players and name of the new game are optional
+	var req struct {
+		GameName string `json:"gamename"`
+		Player1  string `json:"player1"`
+		Player2  string `json:"player2"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	source, err := findGame(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if boardHidden(source) {
+		http.Error(w, "Blindfold games can't be forked until they end", http.StatusForbidden)
+		return
+	}
+
+	ply, err := strconv.Atoi(r.URL.Query().Get("ply"))
+	if err != nil || ply < 0 || ply > len(source.Moves) {
+		http.Error(w, "Invalid ply", http.StatusBadRequest)
+		return
+	}
+	moves := append([]string{}, source.Moves[:ply]...)
+	if _, err := replayMoves(moves); err != nil {
+		http.Error(w, "Cannot replay game: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if req.GameName == "" {
+		req.GameName = gameTitle(source) + " (fork)"
+	}
+	game := Game{
+		GameName: req.GameName,
+		Player1:  req.Player1,
+		Player2:  req.Player2,
+		Moves:    moves,
+		ForkOf:   source.ID,
+		ForkPly:  ply,
+	}
+	if err := insertGame(r.Context(), &game); err != nil {
+		http.Error(w, "Failed to insert game into database", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(game)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// How long the engine thinks about a hint
+const hintMoveTime = 500 * time.Millisecond
+
+// How often a client can ask for a hint in the same game
+const hintInterval = 10 * time.Second
+
+// Hint is a suggested move for the side to move, with a short explanation
+type Hint struct {
+	GameID      string `json:"gameId"`
+	FEN         string `json:"fen"`
+	Move        string `json:"move"`
+	Explanation string `json:"explanation"`
+	Centipawns  *int   `json:"centipawns,omitempty"`
+	Mate        *int   `json:"mate,omitempty"`
+}
+
+var pieceNames = map[byte]string{'p': "pawn", 'n': "knight", 'b': "bishop", 'r': "rook", 'q': "queen", 'k': "king"}
+
+var (
+	hintsMu   sync.Mutex
+	lastHints = make(map[string]time.Time) // Time of the last hint by client and game
+)
+
+// Helper function to get the UCI engine used for hints, from ENGINE_PATH
+func enginePath() string {
+	return os.Getenv("ENGINE_PATH")
+}
+
+// Helper function to get the address a request came from, without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// allowHint records a hint for a client, returning how long they must wait if they asked too recently
+func allowHint(key string, now time.Time) time.Duration {
+	hintsMu.Lock()
+	defer hintsMu.Unlock()
+
+	if wait := lastHints[key].Add(hintInterval).Sub(now); wait > 0 {
+		return wait
+	}
+	lastHints[key] = now
+
+	// Forget clients that could ask again anyway, so the map doesn't grow forever
+	if len(lastHints) > 1000 {
+		for k, t := range lastHints {
+			if now.Sub(t) >= hintInterval {
+				delete(lastHints, k)
+			}
+		}
+	}
+	return 0
+}
+
+// engineBestMove asks the UCI engine for the best move in a position, along
+// with its evaluation in centipawns or moves to mate for the side to move
+func engineBestMove(ctx context.Context, fen string) (move string, centipawns, mate *int, err error) {
+	ctx, span := tracer.Start(ctx, "engine.bestmove")
+	defer span.End()
+	span.SetAttributes(attribute.String("chess.fen", fen))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, hintMoveTime+5*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, enginePath())
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", nil, nil, err
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	commands := fmt.Sprintf("uci\nisready\nucinewgame\nposition fen %s\ngo movetime %d\n", fen, hintMoveTime.Milliseconds())
+	if _, err := io.WriteString(stdin, commands); err != nil {
+		return "", nil, nil, err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "info":
+			// Keep the evaluation of the deepest line seen so far
+			for i := 1; i+2 < len(fields); i++ {
+				if fields[i] != "score" {
+					continue
+				}
+				if n, err := strconv.Atoi(fields[i+2]); err == nil {
+					if fields[i+1] == "cp" {
+						centipawns, mate = &n, nil
+					} else if fields[i+1] == "mate" {
+						centipawns, mate = nil, &n
+					}
+				}
+			}
+		case "bestmove":
+			io.WriteString(stdin, "quit\n")
+			if len(fields) < 2 || fields[1] == "(none)" {
+				return "", nil, nil, fmt.Errorf("engine found no move")
+			}
+			span.SetAttributes(attribute.String("chess.move", fields[1]))
+			return fields[1], centipawns, mate, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, nil, err
+	}
+	return "", nil, nil, fmt.Errorf("engine exited without a move")
+}
+
+// Helper function to tell whether the piece on a square attacks another square
+func attacksSquare(b *Board, from, target int) bool {
+	piece := b.Squares[from]
+	df, dr := target%8-from%8, target/8-from/8
+	abs := func(n int) int {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+
+	// Sliding pieces need every square between them and the target to be empty
+	slides := func() bool {
+		stepF, stepR := sign(df), sign(dr)
+		for sq := from + stepR*8 + stepF; sq != target; sq += stepR*8 + stepF {
+			if b.Squares[sq] != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch strings.ToLower(string(piece))[0] {
+	case 'p':
+		forward := 1
+		if !isWhite(piece) {
+			forward = -1
+		}
+		return dr == forward && abs(df) == 1
+	case 'n':
+		return abs(df)*abs(dr) == 2
+	case 'b':
+		return abs(df) == abs(dr) && df != 0 && slides()
+	case 'r':
+		return (df == 0) != (dr == 0) && slides()
+	case 'q':
+		return ((df == 0) != (dr == 0) || (abs(df) == abs(dr) && df != 0)) && slides()
+	case 'k':
+		return abs(df) <= 1 && abs(dr) <= 1 && (df != 0 || dr != 0)
+	}
+	return false
+}
+
+// Helper function to tell whether the piece on a square gives check to the other side's king
+func checksKing(b *Board, from int) bool {
+	piece := b.Squares[from]
+	if piece == 0 {
+		return false
+	}
+	for sq, p := range b.Squares {
+		if (p == 'k' && isWhite(piece)) || (p == 'K' && !isWhite(piece)) {
+			return attacksSquare(b, from, sq)
+		}
+	}
+	return false
+}
+
+// Helper function to get the sign of a number
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+// explainMove describes in a few words what a move does in a position
+func explainMove(b *Board, move string) string {
+	from, to, promotion, err := parseMove(move)
+	if err != nil || b.Squares[from] == 0 {
+		return "plays " + move
+	}
+	piece := b.Squares[from]
+	kind := strings.ToLower(string(piece))[0]
+	captured := b.Squares[to]
+	name := pieceNames[kind]
+
+	var explanation string
+	switch {
+	case kind == 'k' && isCastling(piece, from, to) && to > from:
+		explanation = "castles kingside to tuck the king away"
+	case kind == 'k' && isCastling(piece, from, to):
+		explanation = "castles queenside to tuck the king away"
+	case kind == 'p' && (to/8 == 0 || to/8 == 7):
+		if promotion == 0 {
+			promotion = 'q'
+		}
+		explanation = fmt.Sprintf("promotes the pawn to a %s on %s", pieceNames[promotion], squareName(to))
+	case captured != 0:
+		explanation = fmt.Sprintf("captures the %s on %s with the %s", pieceNames[strings.ToLower(string(captured))[0]], squareName(to), name)
+	case kind == 'p' && to == b.EnPassant && from%8 != to%8:
+		explanation = "captures the pawn en passant"
+	case (kind == 'n' || kind == 'b') && (from/8 == 0 || from/8 == 7):
+		explanation = fmt.Sprintf("develops the %s to %s", name, squareName(to))
+	case kind == 'p' && (to == 27 || to == 28 || to == 35 || to == 36):
+		explanation = fmt.Sprintf("pushes the pawn to %s to claim the centre", squareName(to))
+	default:
+		explanation = fmt.Sprintf("moves the %s to %s", name, squareName(to))
+	}
+
+	// Look at the position after the move for a check by the moved piece
+	after := *b
+	if after.applyMove(move) == nil && checksKing(&after, to) {
+		explanation += " and gives check"
+	}
+	return explanation
+}
+
+// Handler function to suggest a move for the side to move in an unrated game
+func getGameHint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+	id := mux.Vars(r)["id"]
+
+	if enginePath() == "" {
+		http.Error(w, "Hints are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	game, err := findGame(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if game.Rated || game.ArenaID != "" {
+		http.Error(w, "Hints are disabled in rated and arena games", http.StatusForbidden)
+		return
+	}
+	if game.Result != "" {
+		http.Error(w, "Game is over", http.StatusConflict)
+		return
+	}
+	if boardHidden(game) {
+		http.Error(w, "Hints are disabled in blindfold games", http.StatusForbidden)
+		return
+	}
+
+	board, err := replayMoves(game.Moves)
+	if err != nil {
+		http.Error(w, "Cannot replay game: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if wait := allowHint(clientIP(r)+"/"+id, time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "Too many hint requests", http.StatusTooManyRequests)
+		return
+	}
+
+	fen := board.FEN()
+	move, centipawns, mate, err := engineBestMove(r.Context(), fen)
+	if err != nil {
+		log.Printf("Engine failed on game %s: %v", id, err)
+		http.Error(w, "Failed to get a hint", http.StatusBadGateway)
+		return
+	}
+
+	json.NewEncoder(w).Encode(Hint{
+		GameID:      id,
+		FEN:         fen,
+		Move:        move,
+		Explanation: explainMove(board, move),
+		Centipawns:  centipawns,
+		Mate:        mate,
+	})
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -16,7 +19,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 // Game represents a chess game
@@ -26,8 +30,19 @@ type Game struct {
 	Player1     string    `json:"player1,omitempty" bson:"player1,omitempty"`
 	Player2     string    `json:"player2,omitempty" bson:"player2,omitempty"`
 	Moves       []string  `json:"moves,omitempty" bson:"moves,omitempty"`
+	TimeControl string    `json:"timeControl,omitempty" bson:"timeControl,omitempty"`
+	Rated       bool      `json:"rated,omitempty" bson:"rated,omitempty"`
+	Blindfold   string    `json:"blindfold,omitempty" bson:"blindfold,omitempty"`
+	Result      string    `json:"result,omitempty" bson:"result,omitempty"`
+	DrawOffer   string    `json:"drawOffer,omitempty" bson:"drawOffer,omitempty"`
+	SimulID     string    `json:"simulId,omitempty" bson:"simulId,omitempty"`
+	ArenaID     string    `json:"arenaId,omitempty" bson:"arenaId,omitempty"`
+	VoteChessID string    `json:"voteChessId,omitempty" bson:"voteChessId,omitempty"`
+	ForkOf      string    `json:"forkOf,omitempty" bson:"forkOf,omitempty"`
+	ForkPly     int       `json:"forkPly,omitempty" bson:"forkPly,omitempty"`
 	CreatedAt   time.Time `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
 	LastUpdated time.Time `json:"lastUpdated,omitempty" bson:"lastUpdated,omitempty"`
+	FinishedAt  time.Time `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
 }
 
 var client *mongo.Client
@@ -38,62 +53,93 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	// Set up tracing
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	// Flush spans still waiting to be exported once the server has stopped
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
 	// Get MongoDB connection URI from environment variables
 	url := os.Getenv("MONGODB_URI")
 	if url == "" {
 		log.Fatal("MONGODB_URI")
 	}
 
-	// Create MongoDB client options
-	clientOptions := options.Client().ApplyURI(url)
+	// Create MongoDB client options, tracing every command
+	clientOptions := options.Client().ApplyURI(url).SetMonitor(otelmongo.NewMonitor())
 
 	// Connect to MongoDB
-	var err error
 	client, err = mongo.Connect(context.Background(), clientOptions)
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
+	// Disconnect on shutdown without exiting, so the traces are still flushed afterwards
 	defer func() {
-		err = client.Ping(context.Background(), readpref.Primary())
 		if err := client.Disconnect(context.Background()); err != nil {
 			log.Printf("Error disconnecting from MongoDB: %v", err)
-			log.Fatal(err)
 		}
-		Database, err := client.ListDatabaseNames(context.Background(), bson.M{})
-		if err != nil {
-			log.Fatalf("Failed to connect to MongoDB: %v", err)
-		} else {
-			fmt.Println("Connected to MongoDB!")
-		}
-		fmt.Println(Database)
 	}()
 
 	// Initialize router
 	router := mux.NewRouter()
 
-	// Define API endpoints
-	// router.HandleFunc("/games", getGames).Methods("GET")
-	router.HandleFunc("/games", createGame).Methods("POST")
-	router.HandleFunc("/games/{id}", getGame).Methods("GET")
-	router.HandleFunc("/games/{id}", updateGame).Methods("PUT")
-	router.HandleFunc("/games/{id}", deleteGame).Methods("DELETE")
+	// Trace every request, continuing any trace started by the client
+	router.Use(otelmux.Middleware(serviceName))
+
+	// Turn handler panics into 500 responses and report them
+	initErrorReporter()
+	router.Use(recoverPanics)
+
+	// Define API endpoints under the versioned prefix
+	registerRoutes(router.PathPrefix(apiV1Prefix).Subrouter())
+
+	// Keep the unversioned paths working for existing clients, flagged as deprecated
+	legacy := router.NewRoute().Subrouter()
+	legacy.Use(deprecated)
+	registerLegacyRoutes(legacy)
+
+	// Pair players in running arena tournaments
+	go runArenaPairing()
+
+	// Award achievements for finished games
+	go runAchievements()
+
+	// Play the winning moves of vote chess games
+	go runVoteChess()
+
+	// Telegram turn notifications and commands
+	initTelegram()
+
+	// Discord slash commands
+	initDiscord()
+	router.HandleFunc("/discord/interactions", discordInteractions).Methods("POST")
+
+	// Serve the web UI for everything else
+	router.PathPrefix("/").Handler(uiHandler()).Methods("GET", "HEAD")
 
 	// Set up CORS middleware
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"http://localhost:3000"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders: []string{"Accept", "Content-Type", "X-Requested-With", requestIDHeader},
+		ExposedHeaders: []string{"Deprecation", "Sunset", "Link", requestIDHeader},
 	})
 
 	// Wrap the router with CORS middleware
 	handler := c.Handler(router)
 
-	// Start HTTP server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	log.Printf("Server listening on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+	// Start HTTP server, running until the process is interrupted or terminated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serve(ctx, handler)
 
 }
 
@@ -102,6 +148,68 @@ func getCollection() *mongo.Collection {
 	return client.Database("chess").Collection("games")
 }
 
+// Helper function to find a game by its hex ID
+func findGame(ctx context.Context, hexId string) (Game, error) {
+	var game Game
+	id, err := primitive.ObjectIDFromHex(hexId)
+	if err != nil {
+		return game, err
+	}
+	err = getCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&game)
+	return game, err
+}
+
+// Returned when an update would change the result of a finished game
+var errGameFinished = errors.New("game is already finished")
+
+// applyGameUpdate sets fields of a game and notifies listeners of the change.
+// An update that records a result only applies while the game has no result
+// (or already has that same one), so a game is finished exactly once.
+func applyGameUpdate(ctx context.Context, id string, set interface{}, result string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": objID}
+	update := bson.M{"$set": set}
+	if result != "" {
+		filter["result"] = bson.M{"$in": bson.A{nil, "", result}}
+		// Keeps the time the result was first recorded
+		update["$min"] = bson.M{"finishedAt": time.Now()}
+	}
+
+	// The document as it was just before this update, to tell what changed
+	var previous Game
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	err = getCollection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous)
+	if err == mongo.ErrNoDocuments && result != "" {
+		if _, findErr := findGame(ctx, id); findErr == nil {
+			return errGameFinished
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	game, err := findGame(ctx, id)
+	if err != nil {
+		return err
+	}
+	// Only the update that recorded the result finishes the game
+	if result == "" {
+		previous.Result = game.Result
+	}
+	gameUpdated(ctx, previous, game)
+	return nil
+}
+
+// Helper function to set fields of a game and notify listeners of the change
+func setGameFields(ctx context.Context, game Game, fields bson.M) error {
+	fields["lastUpdated"] = time.Now()
+	result, _ := fields["result"].(string)
+	return applyGameUpdate(ctx, game.ID, fields, result)
+}
+
 // func testCollection() *mongo.Collection {
 // 	err = client.Ping(context.TODO(), nil)
 // 	if err != nil {
@@ -123,26 +231,69 @@ func createGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set CreatedAt and LastUpdated timestamps
-	game.CreatedAt = time.Now()
-	game.LastUpdated = game.CreatedAt
-
-	// Get the MongoDB collection
-	collection := getCollection()
+	if !validResult(game.Result) {
+		http.Error(w, "Invalid result", http.StatusBadRequest)
+		return
+	}
+	if !validTimeControl(game.TimeControl) {
+		http.Error(w, "Invalid time control", http.StatusBadRequest)
+		return
+	}
+	if !validBlindfold(game.Blindfold) {
+		http.Error(w, "Invalid blindfold option", http.StatusBadRequest)
+		return
+	}
+	clearServerFields(&game)
 
 	// Insert the game document into the collection
-	result, err := collection.InsertOne(context.Background(), game)
-	if err != nil {
+	if err := insertGame(r.Context(), &game); err != nil {
 		http.Error(w, "Failed to insert game into database", http.StatusInternalServerError)
 		return
 	}
 
-	// Set the ID of the inserted game and return it in the response
-	game.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	// Return the inserted game, including its ID, in the response
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(game)
 }
 
+// Helper function to insert a new game and set its ID
+func insertGame(ctx context.Context, game *Game) error {
+	// Set CreatedAt and LastUpdated timestamps
+	game.CreatedAt = time.Now()
+	game.LastUpdated = game.CreatedAt
+
+	result, err := getCollection().InsertOne(ctx, game)
+	if err != nil {
+		return err
+	}
+
+	game.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	gameCreated(*game)
+	return nil
+}
+
+// Helper function to drop the fields of a game that only the server sets,
+// linking it to simuls, arenas, vote chess and forks or tracking draw offers
+// and when it finished
+func clearServerFields(game *Game) {
+	game.DrawOffer = ""
+	game.SimulID = ""
+	game.ArenaID = ""
+	game.VoteChessID = ""
+	game.ForkOf = ""
+	game.ForkPly = 0
+	game.FinishedAt = time.Time{}
+}
+
+// Helper function to check a game result is one of "1-0", "0-1" or "1/2-1/2", or empty while in progress
+func validResult(result string) bool {
+	switch result {
+	case "", "1-0", "0-1", "1/2-1/2":
+		return true
+	}
+	return false
+}
+
 // // Handler function to create a new game
 // func createGame(w http.ResponseWriter, r *http.Request) {
 // 	w.Header().Set("Content-Type", "application/json")
@@ -190,7 +341,7 @@ func getGame(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create a filter to find the document by ID
-	gameDoc := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&game)
+	gameDoc := collection.FindOne(r.Context(), bson.M{"_id": id}).Decode(&game)
 
 	// Find the document by ID
 	if gameDoc != nil {
@@ -217,27 +368,42 @@ func updateGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !validResult(updatedGame.Result) {
+		http.Error(w, "Invalid result", http.StatusBadRequest)
+		return
+	}
+
+	// Blindfold, rated and the time control are fixed when the game is created, so they can't be changed mid-game
+	updatedGame.Blindfold = ""
+	updatedGame.Rated = false
+	updatedGame.TimeControl = ""
+	clearServerFields(&updatedGame)
+
 	// Set the LastUpdated timestamp
 	updatedGame.LastUpdated = time.Now()
 
 	// Convert the ID string to BSON ObjectID
-	objID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
 		http.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
 
-	// Get the MongoDB collection
-	collection := getCollection()
-
-	// Define the filter to find the document by ID
-	filter := bson.M{"_id": objID}
-
-	// Define the update operation
-	update := bson.M{"$set": updatedGame}
+	current, err := findGame(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if current.VoteChessID != "" && len(updatedGame.Moves) > 0 {
+		http.Error(w, "Moves in vote chess games are chosen by vote", http.StatusConflict)
+		return
+	}
 
 	// Perform the update operation
-	_, err = collection.UpdateOne(context.Background(), filter, update)
+	err = applyGameUpdate(r.Context(), id, updatedGame, updatedGame.Result)
+	if err == errGameFinished {
+		http.Error(w, "Game is already finished", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -261,7 +427,7 @@ func deleteGame(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete the document by ID
-	_, err = getCollection().DeleteOne(context.Background(), bson.M{"_id": objID})
+	_, err = getCollection().DeleteOne(r.Context(), bson.M{"_id": objID})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1,78 +1,166 @@
-// package main
-
-// import (
-// 	"log"
-// 	"net/http"
-
-// 	"github.com/gorilla/websocket"
-// )
-
-// var clients = make(map[*websocket.Conn]bool) // Connected clients
-// var broadcast = make(chan Message)           // Broadcast channel
-
-// // Message struct for WebSocket messages
-// type Message struct {
-// 	Username string `json:"username"`
-// 	Message  string `json:"message"`
-// }
-
-// var upgrader = websocket.Upgrader{
-// 	CheckOrigin: func(r *http.Request) bool {
-// 		return true
-// 	},
-// }
-
-// func handleConnections(w http.ResponseWriter, r *http.Request) {
-// 	// Upgrade initial GET request to a WebSocket
-// 	ws, err := upgrader.Upgrade(w, r, nil)
-// 	if err != nil {
-// 		log.Fatal(err)
-// 	}
-// 	defer ws.Close()
-
-// 	// Register new client
-// 	clients[ws] = true
-
-// 	for {
-// 		var msg Message
-// 		// Read message from client
-// 		err := ws.ReadJSON(&msg)
-// 		if err != nil {
-// 			log.Printf("error: %v", err)
-// 			delete(clients, ws)
-// 			break
-// 		}
-// 		// Send received message to broadcast channel
-// 		broadcast <- msg
-// 	}
-// }
-
-// func handleMessages() {
-
-// 	for {
-// 		// Get next message from broadcast channel
-// 		msg := <-broadcast
-// 		// Send message to every connected client
-// 		for client := range clients {
-// 			err := client.WriteJSON(msg)
-// 			if err != nil {
-// 				log.Printf("error: %v", err)
-// 				client.Close()
-// 				delete(clients, client)
-// 			}
-// 		}
-// 	}
-// }
-
-// func messenger() {
-// 	// Configure WebSocket route
-// 	http.HandleFunc("/ws", handleConnections)
-// 	// Start listening for incoming chat messages
-// 	go handleMessages()
-// 	// Start server
-// 	log.Println("Server started")
-// 	err := http.ListenAndServe(":8080", nil)
-// 	if err != nil {
-// 		log.Fatal("ListenAndServe: ", err)
-// 	}
-// }
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// How long a write to a WebSocket client may take before the client is dropped
+const writeWait = 5 * time.Second
+
+// Message struct for WebSocket messages
+type Message struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// subscriber is a WebSocket client listening on a topic
+type subscriber struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+// Helper function to send a message to a subscriber, one writer at a time. A
+// client that doesn't take the message within writeWait gets an error, so a
+// stalled connection can't hold up broadcasts.
+func (s *subscriber) send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return s.conn.WriteJSON(msg)
+}
+
+var (
+	topicsMu sync.Mutex
+	topics   = make(map[string]map[*subscriber]bool) // Connected clients by topic
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// Helper function to get the topic on which updates of a game are broadcast
+func gameTopic(id string) string {
+	return "game:" + id
+}
+
+// Helper function to report whether any client is subscribed to a topic
+func hasSubscribers(topic string) bool {
+	topicsMu.Lock()
+	defer topicsMu.Unlock()
+	return len(topics[topic]) > 0
+}
+
+// broadcast sends a message to every client subscribed to a topic
+func broadcast(ctx context.Context, topic string, msg Message) {
+	topicsMu.Lock()
+	subs := make([]*subscriber, 0, len(topics[topic]))
+	for sub := range topics[topic] {
+		subs = append(subs, sub)
+	}
+	topicsMu.Unlock()
+
+	_, span := tracer.Start(ctx, "websocket.broadcast")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("websocket.topic", topic),
+		attribute.String("websocket.message.type", msg.Type),
+		attribute.Int("websocket.subscribers", len(subs)),
+	)
+
+	for _, sub := range subs {
+		if err := sub.send(msg); err != nil {
+			// Drop the client right away, later broadcasts shouldn't wait on it again
+			log.Printf("Dropping WebSocket subscriber of %s: %v", topic, err)
+			unsubscribe(topic, sub)
+			sub.conn.Close()
+		}
+	}
+}
+
+// Helper function to remove a client from a topic
+func unsubscribe(topic string, sub *subscriber) {
+	topicsMu.Lock()
+	defer topicsMu.Unlock()
+	delete(topics[topic], sub)
+	if len(topics[topic]) == 0 {
+		delete(topics, topic)
+	}
+}
+
+// subscribe upgrades the request to a WebSocket and registers it on a topic
+// until the client disconnects. The initial message, if any, is sent right
+// after the upgrade; messages read from the client are passed to onMessage,
+// with a context carrying the span of that message.
+func subscribe(w http.ResponseWriter, r *http.Request, topic string, initial *Message, onMessage func(context.Context, Message)) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade WebSocket: %v", err)
+		return
+	}
+	defer ws.Close()
+
+	sub := &subscriber{conn: ws}
+	if initial != nil {
+		if err := sub.send(*initial); err != nil {
+			log.Printf("error: %v", err)
+			return
+		}
+	}
+
+	// Register new client
+	topicsMu.Lock()
+	if topics[topic] == nil {
+		topics[topic] = make(map[*subscriber]bool)
+	}
+	topics[topic][sub] = true
+	topicsMu.Unlock()
+
+	defer unsubscribe(topic, sub)
+
+	for {
+		var msg Message
+		// Read message from client
+		if err := ws.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("error: %v", err)
+			}
+			return
+		}
+		if onMessage != nil {
+			// The span name is fixed, since the message type comes from the client
+			ctx, span := tracer.Start(r.Context(), "websocket.message")
+			span.SetAttributes(attribute.String("websocket.message.type", msg.Type))
+			onMessage(ctx, msg)
+			span.End()
+		}
+	}
+}
+
+// Handler function to watch a game live over a WebSocket
+func watchGame(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+	id := mux.Vars(r)["id"]
+
+	game, err := findGame(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	subscribe(w, r, gameTopic(id), &Message{Type: "game", Data: game}, nil)
+}
+
+// Helper function to push the latest state of a game to its watchers
+func publishGame(ctx context.Context, game Game) {
+	broadcast(ctx, gameTopic(game.ID), Message{Type: "game", Data: game})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Page served to link unfurlers, carrying Open Graph and Twitter card metadata.
+// Its own URL is the canonical one, since crawlers drop the UI link's fragment.
+// Browsers are sent on to the game in the UI.
+var ogTemplate = template.Must(template.New("og").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <meta name="description" content="{{.Description}}">
+  <meta property="og:type" content="website">
+  <meta property="og:site_name" content="Chess">
+  <meta property="og:title" content="{{.Title}}">
+  <meta property="og:description" content="{{.Description}}">
+  <meta property="og:url" content="{{.URL}}">
+  {{- if .ImageURL}}
+  <meta property="og:image" content="{{.ImageURL}}">
+  <meta property="og:image:type" content="image/png">
+  <meta property="og:image:width" content="{{.ImageWidth}}">
+  <meta property="og:image:height" content="{{.ImageHeight}}">
+  <meta name="twitter:card" content="summary_large_image">
+  <meta name="twitter:image" content="{{.ImageURL}}">
+  {{- else}}
+  <meta name="twitter:card" content="summary">
+  {{- end}}
+  <meta name="twitter:title" content="{{.Title}}">
+  <meta name="twitter:description" content="{{.Description}}">
+  <link rel="canonical" href="{{.URL}}">
+</head>
+<body>
+  <h1>{{.Title}}</h1>
+  <p>{{.Description}}</p>
+  {{- if .ImageURL}}
+  <p><img src="{{.ImageURL}}" alt="Current position" width="600"></p>
+  {{- end}}
+  <p><a href="{{.GameURL}}">Open the game</a></p>
+  <script>location.replace({{.GameURL}});</script>
+</body>
+</html>
+`))
+
+// Helper function to get the public base URL of the server, for absolute links
+func publicURL(r *http.Request) string {
+	if base := os.Getenv("PUBLIC_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// Helper function to get the link to a game in the web UI
+func gameURL(base, id string) string {
+	return base + "/#/games/" + id
+}
+
+// Helper function to get a display title for a game
+func gameTitle(game Game) string {
+	if game.GameName == "" {
+		return "Chess game"
+	}
+	return game.GameName
+}
+
+// Helper function to describe a game for link previews
+func describeGame(game Game, board *Board) string {
+	players := fmt.Sprintf("%s vs %s", orUnknown(game.Player1), orUnknown(game.Player2))
+	moves := fmt.Sprintf("%d moves", (len(game.Moves)+1)/2)
+	if len(game.Moves) == 0 {
+		return players + " · not started"
+	}
+	toMove := "White to move"
+	if !board.WhiteToMove {
+		toMove = "Black to move"
+	}
+	return players + " · " + moves + " · " + toMove
+}
+
+// Helper function to show a placeholder for missing player names
+func orUnknown(name string) string {
+	if name == "" {
+		return "?"
+	}
+	return name
+}
+
+// Handler function to serve a page with link preview metadata for a game
+func getGameOpenGraph(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+	id := mux.Vars(r)["id"]
+
+	game, err := findGame(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	board, err := replayMoves(game.Moves)
+	if err != nil {
+		log.Printf("Showing partial position for game %s: %v", id, err)
+	}
+
+	base := publicURL(r)
+	imageURL := base + apiV1Prefix + "/games/" + id + "/image.png"
+	if boardHidden(game) {
+		imageURL = ""
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = ogTemplate.Execute(w, map[string]interface{}{
+		"Title":       gameTitle(game),
+		"Description": describeGame(game, board),
+		"URL":         base + apiV1Prefix + "/games/" + id + "/og",
+		"GameURL":     gameURL(base, id),
+		"ImageURL":    imageURL,
+		"ImageWidth":  imageWidth,
+		"ImageHeight": imageHeight,
+	})
+	if err != nil {
+		log.Printf("Failed to render Open Graph page: %v", err)
+	}
+}
+
+// Handler function to render the current position of a game as a PNG image
+func getGameImage(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+	id := mux.Vars(r)["id"]
+
+	game, err := findGame(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if boardHidden(game) {
+		http.Error(w, "Board is hidden until the game ends", http.StatusForbidden)
+		return
+	}
+
+	image := gameBoardPNG(game)
+	if image == nil {
+		http.Error(w, "Failed to render board", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	// Games change as moves are played, so only cache briefly
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Write(image)
+}
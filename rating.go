@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Glicko-2 parameters
+const (
+	defaultRating     = 1500.0
+	defaultDeviation  = 350.0
+	defaultVolatility = 0.06
+	minDeviation      = 45.0
+	glickoTau         = 0.75
+	glickoScale       = 173.7178
+	glickoEpsilon     = 0.000001
+)
+
+// Players whose rating deviation is above this are provisional
+const provisionalDeviation = 110.0
+
+// Rating categories, by expected game duration
+const (
+	categoryBullet         = "bullet"
+	categoryBlitz          = "blitz"
+	categoryRapid          = "rapid"
+	categoryClassical      = "classical"
+	categoryCorrespondence = "correspondence"
+)
+
+var ratingCategories = []string{categoryBullet, categoryBlitz, categoryRapid, categoryClassical, categoryCorrespondence}
+
+// Most players a leaderboard returns
+const maxLeaderboardSize = 200
+
+// Longest initial time and increment a time control can have
+const (
+	maxInitialTime = 3 * time.Hour
+	maxIncrement   = 3 * time.Minute
+)
+
+// Rating is a player's rating and record in one category
+type Rating struct {
+	Rating      float64   `json:"rating" bson:"rating"`
+	Deviation   float64   `json:"deviation" bson:"deviation"`
+	Volatility  float64   `json:"volatility" bson:"volatility"`
+	Provisional bool      `json:"provisional" bson:"-"`
+	Games       int       `json:"games" bson:"games"`
+	Wins        int       `json:"wins" bson:"wins"`
+	Draws       int       `json:"draws" bson:"draws"`
+	Losses      int       `json:"losses" bson:"losses"`
+	UpdatedAt   time.Time `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// Player holds a player's ratings by category
+type Player struct {
+	Name    string            `json:"name" bson:"_id"`
+	Ratings map[string]Rating `json:"ratings" bson:"ratings"`
+}
+
+// PlayerProfile is a player as shown to clients, with a rating in every category
+type PlayerProfile struct {
+	Player
+	RatingFloor float64 `json:"ratingFloor"`
+}
+
+// LeaderboardEntry is a player's place on a category leaderboard
+type LeaderboardEntry struct {
+	Name string `json:"name"`
+	Rating
+}
+
+// Serialises rating updates, which read and write both players of a game
+var ratingsMu sync.Mutex
+
+// Helper function to get the MongoDB collection of players
+func getPlayers() *mongo.Collection {
+	return client.Database("chess").Collection("players")
+}
+
+// Helper function to get the lowest rating a player can drop to, from RATING_FLOOR
+func ratingFloor() float64 {
+	floor, err := strconv.ParseFloat(getenv("RATING_FLOOR", "400"), 64)
+	if err != nil {
+		log.Printf("Ignoring invalid RATING_FLOOR: %v", err)
+		return 400
+	}
+	return floor
+}
+
+// Helper function to get the default rating of a player who has not played in a category
+func newRating() Rating {
+	return Rating{Rating: defaultRating, Deviation: defaultDeviation, Volatility: defaultVolatility, Provisional: true}
+}
+
+// Helper function to get a player's rating in a category
+func (p Player) rating(category string) Rating {
+	if rating, ok := p.Ratings[category]; ok {
+		rating.Provisional = rating.Deviation > provisionalDeviation
+		return rating
+	}
+	return newRating()
+}
+
+// Helper function to load a player, with no ratings if they have not played a rated game
+func findPlayer(ctx context.Context, name string) (Player, error) {
+	var player Player
+	err := getPlayers().FindOne(ctx, bson.M{"_id": name}).Decode(&player)
+	if err == mongo.ErrNoDocuments {
+		return Player{Name: name}, nil
+	}
+	return player, err
+}
+
+// Helper function to build the profile shown for a player
+func playerProfile(player Player) PlayerProfile {
+	ratings := make(map[string]Rating, len(ratingCategories))
+	for _, category := range ratingCategories {
+		ratings[category] = player.rating(category)
+	}
+	return PlayerProfile{
+		Player:      Player{Name: player.Name, Ratings: ratings},
+		RatingFloor: ratingFloor(),
+	}
+}
+
+// parseTimeControl parses a time control such as "5+3" (minutes plus increment
+// in seconds). An empty time control means the game is untimed.
+func parseTimeControl(tc string) (initial, increment time.Duration, err error) {
+	parts := strings.SplitN(tc, "+", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("time control must look like 5+3")
+	}
+	// Checked against the maximum before converting, so huge, infinite and NaN values can't overflow
+	minutes, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || !(minutes >= 0 && minutes <= maxInitialTime.Minutes()) {
+		return 0, 0, fmt.Errorf("invalid initial time %q", parts[0])
+	}
+	seconds, err := strconv.Atoi(parts[1])
+	if err != nil || seconds < 0 || seconds > int(maxIncrement.Seconds()) {
+		return 0, 0, fmt.Errorf("invalid increment %q", parts[1])
+	}
+	if minutes == 0 && seconds == 0 {
+		return 0, 0, fmt.Errorf("time control cannot be 0+0")
+	}
+	return time.Duration(minutes * float64(time.Minute)), time.Duration(seconds) * time.Second, nil
+}
+
+// gameCategory gets the rating category of a time control from the expected
+// game duration, initial time plus 40 increments. Untimed games are correspondence.
+func gameCategory(tc string) string {
+	initial, increment, err := parseTimeControl(tc)
+	if tc == "" || err != nil {
+		return categoryCorrespondence
+	}
+	switch estimated := initial + 40*increment; {
+	case estimated < 3*time.Minute:
+		return categoryBullet
+	case estimated < 8*time.Minute:
+		return categoryBlitz
+	case estimated < 25*time.Minute:
+		return categoryRapid
+	default:
+		return categoryClassical
+	}
+}
+
+// Helper function to check a game's time control, which may be left empty
+func validTimeControl(tc string) bool {
+	if tc == "" {
+		return true
+	}
+	_, _, err := parseTimeControl(tc)
+	return err == nil
+}
+
+// Helper function to check a rating category name
+func validCategory(category string) bool {
+	for _, c := range ratingCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// glickoResult is one game of a rating period, scored 1 for a win, 0.5 for a draw, 0 for a loss
+type glickoResult struct {
+	opponent Rating
+	score    float64
+}
+
+// glicko2 returns the player's rating, deviation and volatility after a
+// single game against opponent with the given score (1 win, 0.5 draw, 0 loss),
+// treating the game as its own rating period.
+func glicko2(player, opponent Rating, score float64) (rating, deviation, volatility float64) {
+	return glicko2Period(player, []glickoResult{{opponent, score}}, glickoTau)
+}
+
+// glicko2Period returns the player's rating, deviation and volatility after
+// the games of one rating period, with the system constant tau
+func glicko2Period(player Rating, results []glickoResult, tau float64) (rating, deviation, volatility float64) {
+	mu := (player.Rating - defaultRating) / glickoScale
+	phi := player.Deviation / glickoScale
+	sigma := player.Volatility
+
+	var vInv, improvement float64
+	for _, result := range results {
+		muOpp := (result.opponent.Rating - defaultRating) / glickoScale
+		phiOpp := result.opponent.Deviation / glickoScale
+		g := 1 / math.Sqrt(1+3*phiOpp*phiOpp/(math.Pi*math.Pi))
+		expected := 1 / (1 + math.Exp(-g*(mu-muOpp)))
+		vInv += g * g * expected * (1 - expected)
+		improvement += g * (result.score - expected)
+	}
+	v := 1 / vInv
+	delta := v * improvement
+
+	// Find the new volatility with the Illinois algorithm
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+	lo := a
+	var hi float64
+	if delta*delta > phi*phi+v {
+		hi = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		hi = a - k*tau
+	}
+	fLo, fHi := f(lo), f(hi)
+	for math.Abs(hi-lo) > glickoEpsilon {
+		mid := lo + (lo-hi)*fLo/(fHi-fLo)
+		fMid := f(mid)
+		if fMid*fHi <= 0 {
+			lo, fLo = hi, fHi
+		} else {
+			fLo /= 2
+		}
+		hi, fHi = mid, fMid
+	}
+	volatility = math.Exp(lo / 2)
+
+	phiStar := math.Sqrt(phi*phi + volatility*volatility)
+	phiNew := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	muNew := mu + phiNew*phiNew*improvement
+
+	rating = muNew*glickoScale + defaultRating
+	deviation = math.Min(math.Max(phiNew*glickoScale, minDeviation), defaultDeviation)
+	return rating, deviation, volatility
+}
+
+// Helper function to apply the outcome of a game to a player's rating and record
+func ratePlayer(player, opponent Rating, score float64) Rating {
+	rated := player
+	rated.Rating, rated.Deviation, rated.Volatility = glicko2(player, opponent, score)
+	rated.Rating = math.Max(rated.Rating, ratingFloor())
+	rated.Games++
+	switch score {
+	case 1:
+		rated.Wins++
+	case 0:
+		rated.Losses++
+	default:
+		rated.Draws++
+	}
+	rated.UpdatedAt = time.Now()
+	return rated
+}
+
+// updateRatings rates both players of a finished rated game
+func updateRatings(game Game) {
+	if game.Player1 == "" || game.Player2 == "" || game.Player1 == game.Player2 {
+		return
+	}
+
+	var score float64
+	switch game.Result {
+	case "1-0":
+		score = 1
+	case "0-1":
+		score = 0
+	case "1/2-1/2":
+		score = 0.5
+	default:
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ratingsMu.Lock()
+	defer ratingsMu.Unlock()
+
+	white, err := findPlayer(ctx, game.Player1)
+	if err != nil {
+		log.Printf("Failed to load player %s: %v", game.Player1, err)
+		return
+	}
+	black, err := findPlayer(ctx, game.Player2)
+	if err != nil {
+		log.Printf("Failed to load player %s: %v", game.Player2, err)
+		return
+	}
+
+	// Both players are rated against their opponent's rating from before the game
+	category := gameCategory(game.TimeControl)
+	whiteRating, blackRating := white.rating(category), black.rating(category)
+	updates := map[string]Rating{
+		white.Name: ratePlayer(whiteRating, blackRating, score),
+		black.Name: ratePlayer(blackRating, whiteRating, 1-score),
+	}
+	for name, rating := range updates {
+		update := bson.M{"$set": bson.M{"ratings." + category: rating}}
+		_, err := getPlayers().UpdateOne(ctx, bson.M{"_id": name}, update, options.Update().SetUpsert(true))
+		if err != nil {
+			log.Printf("Failed to save %s rating for %s: %v", category, name, err)
+		}
+	}
+}
+
+// Handler function to get a player's profile with their rating
+func getPlayer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	player, err := findPlayer(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(playerProfile(player))
+}
+
+// Handler function to get the top established players in a rating category
+func getLeaderboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	category := r.URL.Query().Get("category")
+	if category == "" {
+		category = categoryBlitz
+	}
+	if !validCategory(category) {
+		http.Error(w, "Invalid category", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxLeaderboardSize {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	// Provisional players are left off leaderboards
+	field := "ratings." + category
+	filter := bson.M{field + ".deviation": bson.M{"$lte": provisionalDeviation}}
+	opts := options.Find().SetSort(bson.M{field + ".rating": -1}).SetLimit(int64(limit))
+	cursor, err := getPlayers().Find(r.Context(), filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var players []Player
+	if err := cursor.All(r.Context(), &players); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(players))
+	for _, player := range players {
+		entries = append(entries, LeaderboardEntry{Name: player.Name, Rating: player.rating(category)})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"category": category,
+		"players":  entries,
+	})
+}
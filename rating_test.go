@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Worked example from Glickman's "Example of the Glicko-2 system"
+func TestGlicko2PeriodGlickmanExample(t *testing.T) {
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	results := []glickoResult{
+		{Rating{Rating: 1400, Deviation: 30}, 1},
+		{Rating{Rating: 1550, Deviation: 100}, 0},
+		{Rating{Rating: 1700, Deviation: 300}, 0},
+	}
+
+	rating, deviation, volatility := glicko2Period(player, results, 0.5)
+	if math.Abs(rating-1464.06) > 0.01 {
+		t.Errorf("rating = %.2f, want 1464.06", rating)
+	}
+	if math.Abs(deviation-151.52) > 0.01 {
+		t.Errorf("deviation = %.2f, want 151.52", deviation)
+	}
+	if math.Abs(volatility-0.05999) > 0.00001 {
+		t.Errorf("volatility = %.5f, want 0.05999", volatility)
+	}
+}
+
+func TestGlicko2SingleGame(t *testing.T) {
+	player := newRating()
+	opponent := newRating()
+
+	won, wonDeviation, _ := glicko2(player, opponent, 1)
+	lost, _, _ := glicko2(player, opponent, 0)
+	drew, _, _ := glicko2(player, opponent, 0.5)
+	if won <= defaultRating || lost >= defaultRating {
+		t.Errorf("win gave %.2f and loss gave %.2f, want above and below %v", won, lost, defaultRating)
+	}
+	if math.Abs(drew-defaultRating) > 0.01 {
+		t.Errorf("draw between equal players gave %.2f, want %v", drew, defaultRating)
+	}
+	if wonDeviation >= defaultDeviation {
+		t.Errorf("deviation after a game = %.2f, want below %v", wonDeviation, defaultDeviation)
+	}
+
+	// An established player's deviation doesn't drop below the minimum
+	established := Rating{Rating: 2000, Deviation: minDeviation, Volatility: defaultVolatility}
+	if _, deviation, _ := glicko2(established, established, 1); deviation < minDeviation {
+		t.Errorf("deviation = %.2f, want at least %v", deviation, minDeviation)
+	}
+}
+
+func TestRatePlayerFloor(t *testing.T) {
+	t.Setenv("RATING_FLOOR", "1450")
+
+	player := Rating{Rating: 1460, Deviation: 200, Volatility: defaultVolatility}
+	rated := ratePlayer(player, newRating(), 0)
+	if rated.Rating != 1450 {
+		t.Errorf("rating after a loss = %.2f, want the floor 1450", rated.Rating)
+	}
+	if rated.Games != 1 || rated.Losses != 1 || rated.Wins != 0 || rated.Draws != 0 {
+		t.Errorf("record = %d games %d/%d/%d, want 1 game 0/0/1", rated.Games, rated.Wins, rated.Draws, rated.Losses)
+	}
+}
+
+func TestPlayerRatingProvisional(t *testing.T) {
+	player := Player{Name: "alice", Ratings: map[string]Rating{
+		categoryBlitz: {Rating: 1800, Deviation: provisionalDeviation - 10},
+		categoryRapid: {Rating: 1700, Deviation: provisionalDeviation + 10},
+	}}
+
+	tests := []struct {
+		category    string
+		rating      float64
+		provisional bool
+	}{
+		{categoryBlitz, 1800, false},
+		{categoryRapid, 1700, true},
+		{categoryBullet, defaultRating, true},
+	}
+	for _, tt := range tests {
+		got := player.rating(tt.category)
+		if got.Rating != tt.rating || got.Provisional != tt.provisional {
+			t.Errorf("rating(%s) = %.0f provisional %v, want %.0f provisional %v",
+				tt.category, got.Rating, got.Provisional, tt.rating, tt.provisional)
+		}
+	}
+}
+
+func TestParseTimeControl(t *testing.T) {
+	tests := []struct {
+		tc        string
+		initial   time.Duration
+		increment time.Duration
+		wantErr   bool
+	}{
+		{tc: "5+3", initial: 5 * time.Minute, increment: 3 * time.Second},
+		{tc: "0.5+0", initial: 30 * time.Second},
+		{tc: "0+1", increment: time.Second},
+		{tc: "", wantErr: true},
+		{tc: "5", wantErr: true},
+		{tc: "0+0", wantErr: true},
+		{tc: "-1+2", wantErr: true},
+		{tc: "5+-2", wantErr: true},
+		{tc: "5+1.5", wantErr: true},
+		{tc: "five+3", wantErr: true},
+		{tc: "180+180", initial: 3 * time.Hour, increment: 3 * time.Minute},
+		{tc: "181+0", wantErr: true},
+		{tc: "5+181", wantErr: true},
+		{tc: "1e300+0", wantErr: true},
+		{tc: "Inf+0", wantErr: true},
+		{tc: "NaN+0", wantErr: true},
+		{tc: "5+9223372036854775807", wantErr: true},
+	}
+	for _, tt := range tests {
+		initial, increment, err := parseTimeControl(tt.tc)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseTimeControl(%q) = %v, %v, want an error", tt.tc, initial, increment)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTimeControl(%q) failed: %v", tt.tc, err)
+			continue
+		}
+		if initial != tt.initial || increment != tt.increment {
+			t.Errorf("parseTimeControl(%q) = %v, %v, want %v, %v", tt.tc, initial, increment, tt.initial, tt.increment)
+		}
+	}
+}
+
+func TestGameCategory(t *testing.T) {
+	tests := []struct {
+		tc       string
+		category string
+	}{
+		{"1+0", categoryBullet},
+		{"2+1", categoryBullet}, // 2m40s expected
+		{"0+5", categoryBlitz},  // 3m20s expected
+		{"3+2", categoryBlitz},
+		{"5+3", categoryBlitz},
+		{"8+0", categoryRapid},
+		{"10+5", categoryRapid},
+		{"15+10", categoryRapid},
+		{"25+0", categoryClassical},
+		{"90+30", categoryClassical},
+		{"", categoryCorrespondence},
+		{"not a time control", categoryCorrespondence},
+		{"Inf+0", categoryCorrespondence},
+		{"1e300+0", categoryCorrespondence},
+	}
+	for _, tt := range tests {
+		if got := gameCategory(tt.tc); got != tt.category {
+			t.Errorf("gameCategory(%q) = %s, want %s", tt.tc, got, tt.category)
+		}
+	}
+}
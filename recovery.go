@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header carrying the correlation ID of a request
+const requestIDHeader = "X-Request-ID"
+
+// Longest request ID accepted from a client
+const maxRequestIDLength = 64
+
+// How long sending an error report may take
+const errorReportTimeout = 5 * time.Second
+
+// ErrorReport describes a panic recovered while handling a request
+type ErrorReport struct {
+	CorrelationID string      `json:"correlationId"`
+	Message       string      `json:"message"`
+	Stack         string      `json:"stack"`
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	RemoteAddr    string      `json:"remoteAddr"`
+	UserAgent     string      `json:"userAgent,omitempty"`
+	Header        http.Header `json:"header,omitempty"`
+	Time          time.Time   `json:"time"`
+}
+
+// ErrorReporter forwards recovered panics to an external error tracker
+type ErrorReporter interface {
+	Report(ctx context.Context, report ErrorReport)
+}
+
+// Reporter notified of recovered panics, nil when reporting is disabled
+var errorReporter ErrorReporter
+
+// webhookReporter posts error reports as JSON to a configured URL
+type webhookReporter struct {
+	url    string
+	client *http.Client
+}
+
+// Report sends the error report to the webhook, logging delivery failures
+func (wr *webhookReporter) Report(ctx context.Context, report ErrorReport) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("Failed to encode error report %s: %v", report.CorrelationID, err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wr.url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to build error report %s: %v", report.CorrelationID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := wr.client.Do(req)
+	if err != nil {
+		log.Printf("Failed to send error report %s: %v", report.CorrelationID, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// Helper function to set up the error reporter from ERROR_REPORT_URL, if configured
+func initErrorReporter() {
+	if url := os.Getenv("ERROR_REPORT_URL"); url != "" {
+		errorReporter = &webhookReporter{url: url, client: &http.Client{Timeout: errorReportTimeout}}
+	}
+}
+
+// Helper function to generate a random correlation ID
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Helper function to check a client's request ID is short and only uses
+// characters that are safe to put in logs, spans and error reports
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder remembers whether a handler already started its response
+type statusRecorder struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.wroteHeader = true
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	sr.wroteHeader = true
+	return sr.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the underlying writer so streaming responses keep working
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		sr.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+// Hijack passes through to the underlying writer so WebSocket upgrades keep working
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	sr.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+// recoverPanics tags every request with a correlation ID and turns handler
+// panics into 500 responses carrying that ID instead of dropping the connection
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationID := r.Header.Get(requestIDHeader)
+		if !validRequestID(correlationID) {
+			correlationID = newCorrelationID()
+		}
+		w.Header().Set(requestIDHeader, correlationID)
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attribute.String("request.id", correlationID))
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// Let net/http handle deliberate aborts as usual
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			stack := debug.Stack()
+			log.Printf("Recovered panic handling %s %s [%s]: %v\n%s", r.Method, r.URL.Path, correlationID, p, stack)
+			span.SetStatus(codes.Error, "panic")
+
+			if errorReporter != nil {
+				report := ErrorReport{
+					CorrelationID: correlationID,
+					Message:       fmt.Sprint(p),
+					Stack:         string(stack),
+					Method:        r.Method,
+					URL:           r.URL.String(),
+					RemoteAddr:    r.RemoteAddr,
+					UserAgent:     r.UserAgent(),
+					Header:        redactHeaders(r.Header),
+					Time:          time.Now(),
+				}
+				// Report in the background, so the response isn't held up and the
+				// report isn't dropped when the client goes away
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), errorReportTimeout)
+					defer cancel()
+					errorReporter.Report(ctx, report)
+				}()
+			}
+
+			// Nothing sensible can be sent once the response has started
+			if recorder.wroteHeader {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":         "Internal server error",
+				"correlationId": correlationID,
+			})
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// Helper function to drop credentials from headers before they leave the server
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, key := range []string{"Authorization", "Cookie", "Proxy-Authorization"} {
+		if redacted.Get(key) != "" {
+			redacted.Set(key, "[redacted]")
+		}
+	}
+	return redacted
+}
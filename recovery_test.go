@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"3f2a9c1e-7b4d-4e8a-9c2f-1a2b3c4d5e6f", true},
+		{"req_42.retry", true},
+		{strings.Repeat("a", maxRequestIDLength), true},
+		{"", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+		{"id with spaces", false},
+		{"line\nbreak", false},
+		{"<script>", false},
+		{"ünïcode", false},
+	}
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.valid {
+			t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+)
+
+// Dimensions of rendered board images, sized for link previews
+const (
+	imageWidth  = 1200
+	imageHeight = 630
+	squareSize  = 72
+	glyphScale  = 4
+)
+
+var (
+	backgroundColor = color.RGBA{0x26, 0x24, 0x21, 0xff}
+	lightColor      = color.RGBA{0xf0, 0xd9, 0xb5, 0xff}
+	darkColor       = color.RGBA{0xb5, 0x88, 0x63, 0xff}
+	lightMoveColor  = color.RGBA{0xcd, 0xd2, 0x6a, 0xff}
+	darkMoveColor   = color.RGBA{0xaa, 0xa2, 0x3a, 0xff}
+	whiteFill       = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	whiteOutline    = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	blackFill       = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	blackOutline    = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+)
+
+// Piece silhouettes drawn on a 16x16 grid
+var glyphs = map[byte][16]string{
+	'p': {
+		"................",
+		"................",
+		"................",
+		"......####......",
+		".....######.....",
+		".....######.....",
+		"......####......",
+		".....######.....",
+		"......####......",
+		"......####......",
+		".....######.....",
+		"....########....",
+		"...##########...",
+		"...##########...",
+		"................",
+		"................",
+	},
+	'n': {
+		"................",
+		"................",
+		"......##.#......",
+		".....#######....",
+		"....#########...",
+		"...##.#######...",
+		"..###########...",
+		"..####..#####...",
+		"...##..######...",
+		"......#######...",
+		".....#######....",
+		"....########....",
+		"...##########...",
+		"..############..",
+		"..############..",
+		"................",
+	},
+	'b': {
+		"................",
+		".......##.......",
+		"......####......",
+		".....######.....",
+		"....####.###....",
+		"....###.####....",
+		"....########....",
+		".....######.....",
+		"......####......",
+		".....######.....",
+		"......####......",
+		"......####......",
+		"....########....",
+		"..############..",
+		"..############..",
+		"................",
+	},
+	'r': {
+		"................",
+		"................",
+		"...##..##..##...",
+		"...##########...",
+		"....########....",
+		".....######.....",
+		".....######.....",
+		".....######.....",
+		".....######.....",
+		".....######.....",
+		"....########....",
+		"...##########...",
+		"..############..",
+		"..############..",
+		"................",
+		"................",
+	},
+	'q': {
+		"................",
+		".#....#..#....#.",
+		".##..##..##..##.",
+		".##..##..##..##.",
+		".###.######.###.",
+		"..############..",
+		"..############..",
+		"...##########...",
+		"....########....",
+		"....########....",
+		".....######.....",
+		"....########....",
+		"...##########...",
+		"..############..",
+		"..############..",
+		"................",
+	},
+	'k': {
+		"................",
+		".......##.......",
+		"......####......",
+		".......##.......",
+		"..###..##..###..",
+		".#####.##.#####.",
+		".##############.",
+		".##############.",
+		"..############..",
+		"...##########...",
+		"....########....",
+		"....########....",
+		"...##########...",
+		"..############..",
+		"..############..",
+		"................",
+	},
+}
+
+// renderBoard draws the board, from white's side, centred on a link preview sized image
+func renderBoard(b *Board) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{backgroundColor}, image.Point{}, draw.Src)
+
+	left := (imageWidth - 8*squareSize) / 2
+	top := (imageHeight - 8*squareSize) / 2
+
+	for sq := 0; sq < 64; sq++ {
+		file, rank := sq%8, sq/8
+		x := left + file*squareSize
+		y := top + (7-rank)*squareSize
+
+		light := (file+rank)%2 == 1
+		c := darkColor
+		if light {
+			c = lightColor
+		}
+		if sq == b.LastMove[0] || sq == b.LastMove[1] {
+			c = darkMoveColor
+			if light {
+				c = lightMoveColor
+			}
+		}
+		draw.Draw(img, image.Rect(x, y, x+squareSize, y+squareSize), &image.Uniform{c}, image.Point{}, draw.Src)
+
+		if piece := b.Squares[sq]; piece != 0 {
+			drawPiece(img, piece, x, y)
+		}
+	}
+	return img
+}
+
+// Helper function to draw a piece glyph with an outline inside a square
+func drawPiece(img *image.RGBA, piece byte, x, y int) {
+	fill, outline := blackFill, blackOutline
+	if isWhite(piece) {
+		fill, outline = whiteFill, whiteOutline
+		piece += 'a' - 'A'
+	}
+	glyph, ok := glyphs[piece]
+	if !ok {
+		return
+	}
+
+	filled := func(row, col int) bool {
+		return row >= 0 && row < 16 && col >= 0 && col < 16 && glyph[row][col] == '#'
+	}
+
+	offset := (squareSize - 16*glyphScale) / 2
+	for row := 0; row < 16; row++ {
+		for col := 0; col < 16; col++ {
+			var c color.RGBA
+			switch {
+			case filled(row, col):
+				c = fill
+			case filled(row-1, col) || filled(row+1, col) || filled(row, col-1) || filled(row, col+1):
+				c = outline
+			default:
+				continue
+			}
+			px := x + offset + col*glyphScale
+			py := y + offset + row*glyphScale
+			draw.Draw(img, image.Rect(px, py, px+glyphScale, py+glyphScale), &image.Uniform{c}, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// gameBoardPNG renders the current position of a game as PNG. Games whose
+// moves can't all be replayed show the position up to the first bad move.
+// Returns nil if the image can't be encoded.
+func gameBoardPNG(game Game) []byte {
+	board, err := replayMoves(game.Moves)
+	if err != nil {
+		log.Printf("Showing partial position for game %s: %v", game.ID, err)
+	}
+	var image bytes.Buffer
+	if err := png.Encode(&image, renderBoard(board)); err != nil {
+		log.Printf("Failed to encode board image for game %s: %v", game.ID, err)
+		return nil
+	}
+	return image.Bytes()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// How long open requests get to finish when the server shuts down
+const shutdownTimeout = 10 * time.Second
+
+// Helper function to read an environment variable with a fallback value
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// serve runs the HTTP server until ctx is cancelled, then shuts it down
+// gracefully. When TLS is configured, either with TLS_CERT_FILE/TLS_KEY_FILE
+// or with TLS_AUTOCERT_HOST for Let's Encrypt, the API (and WebSocket
+// upgrades, as wss) is served over HTTPS with HTTP/2 and the plain HTTP port
+// only redirects to it.
+func serve(ctx context.Context, handler http.Handler) {
+	port := getenv("PORT", "8080")
+	certFile := os.Getenv("TLS_CERT_FILE")
+	keyFile := os.Getenv("TLS_KEY_FILE")
+	autocertHost := os.Getenv("TLS_AUTOCERT_HOST")
+	errs := make(chan error, 2)
+
+	if certFile == "" && keyFile == "" && autocertHost == "" {
+		server := &http.Server{Addr: ":" + port, Handler: handler}
+		log.Printf("Server listening on port %s", port)
+		go func() { errs <- server.ListenAndServe() }()
+		waitForShutdown(ctx, errs, server)
+		return
+	}
+
+	tlsPort := getenv("TLS_PORT", "8443")
+	server := &http.Server{Addr: ":" + tlsPort, Handler: handler}
+	redirect := redirectToHTTPS(tlsPort)
+
+	if autocertHost != "" {
+		// Obtain and renew certificates from Let's Encrypt for the configured host
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(autocertHost),
+			Cache:      autocert.DirCache(getenv("TLS_AUTOCERT_CACHE", "certs")),
+		}
+		server.TLSConfig = manager.TLSConfig()
+		// The HTTP port also answers ACME challenges
+		redirect = manager.HTTPHandler(redirect)
+		certFile, keyFile = "", ""
+	} else if certFile == "" || keyFile == "" {
+		log.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must both be set")
+	}
+
+	redirectServer := &http.Server{Addr: ":" + port, Handler: redirect}
+	log.Printf("Redirecting HTTP on port %s to HTTPS", port)
+	go func() { errs <- redirectServer.ListenAndServe() }()
+
+	log.Printf("Server listening on port %s (TLS)", tlsPort)
+	go func() { errs <- server.ListenAndServeTLS(certFile, keyFile) }()
+	waitForShutdown(ctx, errs, server, redirectServer)
+}
+
+// Helper function to wait until ctx is cancelled and then shut the servers
+// down, giving open requests time to finish. A server that fails to start
+// stops the process.
+func waitForShutdown(ctx context.Context, errs <-chan error, servers ...*http.Server) {
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shut down server on %s: %v", server.Addr, err)
+		}
+	}
+}
+
+// Helper function to redirect plain HTTP requests to the HTTPS port
+func redirectToHTTPS(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
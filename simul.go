@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Most boards a single simul can have
+const maxSimulBoards = 100
+
+// Board statuses within a simul
+const (
+	boardHostToMove     = "host-to-move"
+	boardOpponentToMove = "opponent-to-move"
+	boardFinished       = "finished"
+)
+
+// Simul is a simultaneous exhibition: the host plays white on every board
+type Simul struct {
+	ID        string    `json:"id,omitempty" bson:"_id,omitempty"`
+	Name      string    `json:"name,omitempty" bson:"name,omitempty"`
+	Host      string    `json:"host,omitempty" bson:"host,omitempty"`
+	CreatedAt time.Time `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+}
+
+// SimulBoard is the state of one game of a simul
+type SimulBoard struct {
+	GameID   string `json:"gameId"`
+	Opponent string `json:"opponent"`
+	Moves    int    `json:"moves"`
+	LastMove string `json:"lastMove,omitempty"`
+	Status   string `json:"status"`
+	Result   string `json:"result,omitempty"`
+}
+
+// SimulScore is the running score of the host against all opponents
+type SimulScore struct {
+	Host      float64 `json:"host"`
+	Opponents float64 `json:"opponents"`
+	Wins      int     `json:"wins"`
+	Draws     int     `json:"draws"`
+	Losses    int     `json:"losses"`
+	Ongoing   int     `json:"ongoing"`
+}
+
+// SimulView is a simul with the state of all its boards
+type SimulView struct {
+	Simul
+	Boards     []SimulBoard `json:"boards"`
+	HostToMove []SimulBoard `json:"hostToMove"`
+	Score      SimulScore   `json:"score"`
+}
+
+// Helper function to get the MongoDB collection of simuls
+func getSimuls() *mongo.Collection {
+	return client.Database("chess").Collection("simuls")
+}
+
+// Helper function to get the topic on which a simul's host view is broadcast
+func simulTopic(id string) string {
+	return "simul:" + id
+}
+
+// Helper function to load a simul and summarise its boards
+func loadSimulView(ctx context.Context, hexId string) (SimulView, error) {
+	var view SimulView
+	id, err := primitive.ObjectIDFromHex(hexId)
+	if err != nil {
+		return view, err
+	}
+	if err := getSimuls().FindOne(ctx, bson.M{"_id": id}).Decode(&view.Simul); err != nil {
+		return view, err
+	}
+
+	cursor, err := getCollection().Find(ctx, bson.M{"simulId": hexId}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return view, err
+	}
+	var games []Game
+	if err := cursor.All(ctx, &games); err != nil {
+		return view, err
+	}
+
+	view.Boards = make([]SimulBoard, 0, len(games))
+	view.HostToMove = []SimulBoard{}
+	for _, game := range games {
+		board := SimulBoard{GameID: game.ID, Opponent: game.Player2, Moves: len(game.Moves), Result: game.Result}
+		if len(game.Moves) > 0 {
+			board.LastMove = game.Moves[len(game.Moves)-1]
+		}
+
+		switch game.Result {
+		case "1-0":
+			board.Status = boardFinished
+			view.Score.Host++
+			view.Score.Wins++
+		case "0-1":
+			board.Status = boardFinished
+			view.Score.Opponents++
+			view.Score.Losses++
+		case "1/2-1/2":
+			board.Status = boardFinished
+			view.Score.Host += 0.5
+			view.Score.Opponents += 0.5
+			view.Score.Draws++
+		default:
+			view.Score.Ongoing++
+			// The host has white, so it is their turn after an even number of moves
+			board.Status = boardOpponentToMove
+			if len(game.Moves)%2 == 0 {
+				board.Status = boardHostToMove
+				view.HostToMove = append(view.HostToMove, board)
+			}
+		}
+		view.Boards = append(view.Boards, board)
+	}
+	return view, nil
+}
+
+// Handler function to create a simul with a game against each opponent
+func createSimul(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	var req struct {
+		Name      string   `json:"name"`
+		Host      string   `json:"host"`
+		Opponents []string `json:"opponents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if req.Host == "" || len(req.Opponents) == 0 {
+		http.Error(w, "A simul needs a host and at least one opponent", http.StatusBadRequest)
+		return
+	}
+	if len(req.Opponents) > maxSimulBoards {
+		http.Error(w, "Too many opponents", http.StatusBadRequest)
+		return
+	}
+
+	simul := Simul{Name: req.Name, Host: req.Host, CreatedAt: time.Now()}
+	result, err := getSimuls().InsertOne(r.Context(), simul)
+	if err != nil {
+		http.Error(w, "Failed to insert simul into database", http.StatusInternalServerError)
+		return
+	}
+	simul.ID = result.InsertedID.(primitive.ObjectID).Hex()
+
+	// Create one game per opponent, with the host playing white
+	for _, opponent := range req.Opponents {
+		game := Game{
+			GameName: simul.Name,
+			Player1:  simul.Host,
+			Player2:  opponent,
+			SimulID:  simul.ID,
+		}
+		if err := insertGame(r.Context(), &game); err != nil {
+			http.Error(w, "Failed to insert game into database", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	view, err := loadSimulView(r.Context(), simul.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+// Handler function to get a simul with the state of its boards and the score
+func getSimul(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	view, err := loadSimulView(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Simul not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(view)
+}
+
+// Handler function for the host's live view of a simul over a WebSocket.
+// The full view, including the boards where it is the host's turn, is sent
+// on connect and again whenever one of the simul's games changes.
+func watchSimul(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+	id := mux.Vars(r)["id"]
+
+	view, err := loadSimulView(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Simul not found", http.StatusNotFound)
+		return
+	}
+
+	subscribe(w, r, simulTopic(id), &Message{Type: "simul", Data: view}, nil)
+}
+
+// Helper function to push the latest view of a simul to the host
+func publishSimul(ctx context.Context, id string) {
+	if !hasSubscribers(simulTopic(id)) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	view, err := loadSimulView(ctx, id)
+	if err != nil {
+		log.Printf("Failed to load simul %s: %v", id, err)
+		return
+	}
+	broadcast(ctx, simulTopic(id), Message{Type: "simul", Data: view})
+}
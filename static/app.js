@@ -0,0 +1,271 @@
+'use strict';
+
+const API = '/api/v1';
+
+const GLYPHS = {
+  k: '♚', q: '♛', r: '♜', b: '♝', n: '♞', p: '♟',
+};
+
+let current = null; // { game, socket }
+
+// Board replay, mirroring the server: moves are coordinate moves (e2e4, e7e8q)
+// applied without legality checks.
+
+function parseSquare(name) {
+  const file = name.charCodeAt(0) - 97;
+  const rank = name.charCodeAt(1) - 49;
+  if (name.length !== 2 || file < 0 || file > 7 || rank < 0 || rank > 7) {
+    return -1;
+  }
+  return rank * 8 + file;
+}
+
+function squareName(sq) {
+  return String.fromCharCode(97 + (sq % 8)) + String.fromCharCode(49 + Math.floor(sq / 8));
+}
+
+function isWhite(piece) {
+  return piece === piece.toUpperCase();
+}
+
+function newBoard() {
+  const squares = new Array(64).fill(null);
+  const back = 'RNBQKBNR';
+  for (let file = 0; file < 8; file++) {
+    squares[file] = back[file];
+    squares[8 + file] = 'P';
+    squares[48 + file] = 'p';
+    squares[56 + file] = back[file].toLowerCase();
+  }
+  return { squares, whiteToMove: true, enPassant: -1, lastMove: null };
+}
+
+function applyMove(board, move) {
+  const m = move.replace(/[-x=+#]/g, '');
+  const from = parseSquare(m.slice(0, 2));
+  const to = parseSquare(m.slice(2, 4));
+  const piece = board.squares[from];
+  if (from < 0 || to < 0 || !piece) {
+    return false;
+  }
+  // A piece can't capture its own side
+  const target = board.squares[to];
+  if (target && isWhite(target) === isWhite(piece)) {
+    return false;
+  }
+  const kind = piece.toLowerCase();
+  let placed = piece;
+
+  if (kind === 'k' && Math.abs((to % 8) - (from % 8)) === 2) {
+    // Only a king on its home square can castle
+    const home = isWhite(piece) ? 4 : 60;
+    if (from !== home || (to !== home - 2 && to !== home + 2)) {
+      return false;
+    }
+    if (to > from) {
+      board.squares[to - 1] = board.squares[to + 1];
+      board.squares[to + 1] = null;
+    } else {
+      board.squares[to + 1] = board.squares[to - 2];
+      board.squares[to - 2] = null;
+    }
+  } else if (kind === 'p') {
+    if (to === board.enPassant && from % 8 !== to % 8 && !board.squares[to]) {
+      board.squares[board.whiteToMove ? to - 8 : to + 8] = null;
+    }
+    if (to < 8 || to >= 56) {
+      const promotion = (m[4] || 'q').toLowerCase();
+      placed = board.whiteToMove ? promotion.toUpperCase() : promotion;
+    }
+  }
+
+  board.squares[to] = placed;
+  board.squares[from] = null;
+  board.enPassant = kind === 'p' && Math.abs(to - from) === 16 ? (from + to) / 2 : -1;
+  board.whiteToMove = !board.whiteToMove;
+  board.lastMove = [from, to];
+  return true;
+}
+
+function replay(moves) {
+  const board = newBoard();
+  for (const move of moves || []) {
+    if (!applyMove(board, move)) {
+      break;
+    }
+  }
+  return board;
+}
+
+// Rendering
+
+function renderBoard(game) {
+  const board = replay(game.moves);
+  // Blindfold games only show the moves until they end
+  const hidden = game.blindfold && !game.result;
+  const el = document.getElementById('board');
+  el.replaceChildren();
+
+  for (let rank = 7; rank >= 0; rank--) {
+    for (let file = 0; file < 8; file++) {
+      const sq = rank * 8 + file;
+      const square = document.createElement('div');
+      square.className = 'square ' + ((file + rank) % 2 ? 'light' : 'dark');
+      square.dataset.square = squareName(sq);
+      if (board.lastMove && board.lastMove.includes(sq)) {
+        square.classList.add('last-move');
+      }
+
+      const piece = board.squares[sq];
+      if (piece && !hidden) {
+        const span = document.createElement('span');
+        span.className = 'piece ' + (isWhite(piece) ? 'white' : 'black');
+        span.textContent = GLYPHS[piece.toLowerCase()];
+        span.draggable = isWhite(piece) === board.whiteToMove;
+        span.addEventListener('dragstart', (e) => {
+          e.dataTransfer.setData('text/plain', squareName(sq));
+        });
+        square.appendChild(span);
+      }
+
+      square.addEventListener('dragover', (e) => {
+        e.preventDefault();
+        square.classList.add('drop-target');
+      });
+      square.addEventListener('dragleave', () => square.classList.remove('drop-target'));
+      square.addEventListener('drop', (e) => {
+        e.preventDefault();
+        square.classList.remove('drop-target');
+        const from = e.dataTransfer.getData('text/plain');
+        const to = square.dataset.square;
+        if (from && from !== to) {
+          submitMove(board, from, to);
+        }
+      });
+
+      el.appendChild(square);
+    }
+  }
+
+  const status = document.getElementById('status');
+  status.textContent = (board.whiteToMove ? 'White' : 'Black') + ' to move';
+  if (hidden) {
+    status.textContent += ' (blindfold: board hidden until the game ends)';
+  }
+
+  const moves = document.getElementById('moves');
+  moves.replaceChildren();
+  for (const move of game.moves || []) {
+    const li = document.createElement('li');
+    li.textContent = move;
+    moves.appendChild(li);
+  }
+}
+
+function renderGame(game) {
+  current.game = game;
+  document.getElementById('game-title').textContent = game.gamename || 'Game ' + game.id;
+  document.getElementById('game-players').textContent =
+    (game.player1 || '?') + ' (white) vs ' + (game.player2 || '?') + ' (black)';
+  renderBoard(game);
+}
+
+// API
+
+async function submitMove(board, from, to) {
+  let move = from + to;
+  const piece = board.squares[parseSquare(from)];
+  const toRank = to[1];
+  if (piece && piece.toLowerCase() === 'p' && (toRank === '8' || toRank === '1')) {
+    move += 'q';
+  }
+  await playMove(move);
+}
+
+async function playMove(move) {
+  const moves = (current.game.moves || []).concat(move);
+  const res = await fetch(API + '/games/' + current.game.id, {
+    method: 'PUT',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ moves }),
+  });
+  if (!res.ok) {
+    document.getElementById('status').textContent = 'Move rejected: ' + (await res.text());
+  }
+}
+
+function openGame(id) {
+  if (current && current.socket) {
+    current.socket.close();
+  }
+  current = { game: { id, moves: [] }, socket: null };
+
+  document.getElementById('lobby').hidden = true;
+  document.getElementById('game').hidden = false;
+
+  const scheme = location.protocol === 'https:' ? 'wss:' : 'ws:';
+  const socket = new WebSocket(scheme + '//' + location.host + API + '/games/' + id + '/ws');
+  socket.addEventListener('message', (e) => {
+    const msg = JSON.parse(e.data);
+    if (msg.type === 'game') {
+      renderGame(msg.data);
+    }
+  });
+  socket.addEventListener('close', () => {
+    if (current && current.socket === socket) {
+      document.getElementById('status').textContent += ' (disconnected)';
+    }
+  });
+  current.socket = socket;
+}
+
+function showLobby() {
+  if (current && current.socket) {
+    current.socket.close();
+  }
+  current = null;
+  document.getElementById('lobby').hidden = false;
+  document.getElementById('game').hidden = true;
+}
+
+function route() {
+  const match = location.hash.match(/^#\/games\/([0-9a-fA-F]{24})$/);
+  if (match) {
+    openGame(match[1]);
+  } else {
+    showLobby();
+  }
+}
+
+document.getElementById('create-form').addEventListener('submit', async (e) => {
+  e.preventDefault();
+  const form = new FormData(e.target);
+  const res = await fetch(API + '/games', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(Object.fromEntries(form)),
+  });
+  if (!res.ok) {
+    alert('Failed to create game: ' + (await res.text()));
+    return;
+  }
+  const game = await res.json();
+  location.hash = '#/games/' + game.id;
+});
+
+document.getElementById('move-form').addEventListener('submit', async (e) => {
+  e.preventDefault();
+  const input = e.target.elements.move;
+  if (current && input.value) {
+    await playMove(input.value.trim());
+    input.value = '';
+  }
+});
+
+document.getElementById('watch-form').addEventListener('submit', (e) => {
+  e.preventDefault();
+  location.hash = '#/games/' + new FormData(e.target).get('id');
+});
+
+window.addEventListener('hashchange', route);
+route();
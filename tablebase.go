@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Positions with at most this many pieces are covered by Syzygy tables
+const maxTablebasePieces = 7
+
+// TablebaseMove is a single move as rated by the tablebase
+type TablebaseMove struct {
+	UCI      string `json:"uci"`
+	SAN      string `json:"san"`
+	Category string `json:"category"`
+	DTZ      *int   `json:"dtz"`
+}
+
+// TablebaseResult is the exact WDL/DTZ result for a position
+type TablebaseResult struct {
+	FEN                  string          `json:"fen"`
+	Category             string          `json:"category"`
+	WDL                  *int            `json:"wdl"`
+	DTZ                  *int            `json:"dtz"`
+	Checkmate            bool            `json:"checkmate"`
+	Stalemate            bool            `json:"stalemate"`
+	InsufficientMaterial bool            `json:"insufficient_material"`
+	Moves                []TablebaseMove `json:"moves,omitempty"`
+}
+
+var tablebaseClient = &http.Client{Timeout: 5 * time.Second}
+
+// Helper function to get the tablebase endpoint, defaulting to the public lichess API
+func tablebaseURL() string {
+	if u := os.Getenv("TABLEBASE_URL"); u != "" {
+		return u
+	}
+	return "https://tablebase.lichess.ovh/standard"
+}
+
+// Helper function to count the pieces in the placement field of a FEN
+func countPieces(fen string) int {
+	placement := strings.SplitN(fen, " ", 2)[0]
+	count := 0
+	for _, c := range placement {
+		if strings.ContainsRune("pnbrqkPNBRQK", c) {
+			count++
+		}
+	}
+	return count
+}
+
+// Helper function to map a tablebase category onto a WDL score for the side to move
+func categoryToWDL(category string) *int {
+	var wdl int
+	switch category {
+	case "win":
+		wdl = 2
+	case "cursed-win", "maybe-win":
+		wdl = 1
+	case "draw":
+		wdl = 0
+	case "blessed-loss", "maybe-loss":
+		wdl = -1
+	case "loss":
+		wdl = -2
+	default:
+		return nil
+	}
+	return &wdl
+}
+
+// probeTablebase looks up the exact result of a position with few enough pieces
+func probeTablebase(ctx context.Context, fen string) (*TablebaseResult, error) {
+	if n := countPieces(fen); n > maxTablebasePieces {
+		return nil, fmt.Errorf("position has %d pieces, tablebases cover at most %d", n, maxTablebasePieces)
+	}
+
+	ctx, span := tracer.Start(ctx, "tablebase.probe", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tablebaseURL()+"?fen="+url.QueryEscape(fen), nil)
+	if err != nil {
+		return nil, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := tablebaseClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("tablebase returned status %d", resp.StatusCode)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	var result TablebaseResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	result.FEN = fen
+	result.WDL = categoryToWDL(result.Category)
+	return &result, nil
+}
+
+// Handler function to probe the endgame tablebase for a FEN position
+func getTablebase(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	fen := r.URL.Query().Get("fen")
+	if fen == "" {
+		http.Error(w, "Missing fen parameter", http.StatusBadRequest)
+		return
+	}
+
+	if countPieces(fen) > maxTablebasePieces {
+		http.Error(w, "Too many pieces for tablebase lookup", http.StatusBadRequest)
+		return
+	}
+
+	result, err := probeTablebase(r.Context(), fen)
+	if err != nil {
+		log.Printf("Tablebase probe failed: %v", err)
+		http.Error(w, "Failed to probe tablebase", http.StatusBadGateway)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// How long a getUpdates call waits for new messages
+const telegramPollTimeout = 50 * time.Second
+
+// How long a link code can be used for
+const telegramCodeLifetime = 10 * time.Minute
+
+// TelegramLink connects a player to the Telegram chat told when it is their turn
+type TelegramLink struct {
+	Player   string    `bson:"_id"`
+	ChatID   int64     `bson:"chatId"`
+	LinkedAt time.Time `bson:"linkedAt"`
+}
+
+// TelegramCode is a one-time code a player sends to the bot to link their chat
+type TelegramCode struct {
+	Code      string    `json:"code" bson:"_id"`
+	Player    string    `json:"player" bson:"player"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+	} `json:"message"`
+}
+
+var telegramClient = &http.Client{Timeout: telegramPollTimeout + 10*time.Second}
+
+const telegramHelp = `Commands:
+/link <code> - get a message whenever it is your turn, using a code from the API
+/unlink - stop notifications
+/resign <game id> - resign a game
+/draw <game id> - offer a draw, or accept your opponent's offer`
+
+// Helper function to get the MongoDB collection of Telegram links
+func getTelegramLinks() *mongo.Collection {
+	return client.Database("chess").Collection("telegram_links")
+}
+
+// Helper function to get the MongoDB collection of unused link codes
+func getTelegramCodes() *mongo.Collection {
+	return client.Database("chess").Collection("telegram_codes")
+}
+
+// Helper function to generate a random secret of the given number of bytes, hex encoded
+func newSecret(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Helper function to report whether the Telegram bot is configured
+func telegramEnabled() bool {
+	return os.Getenv("TELEGRAM_BOT_TOKEN") != ""
+}
+
+// initTelegram starts polling Telegram for commands when TELEGRAM_BOT_TOKEN is set
+func initTelegram() {
+	if !telegramEnabled() {
+		return
+	}
+	go pollTelegram()
+}
+
+// Helper function to call a Telegram Bot API method
+func telegramCall(ctx context.Context, method, contentType string, body io.Reader, result interface{}) error {
+	url := "https://api.telegram.org/bot" + os.Getenv("TELEGRAM_BOT_TOKEN") + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := telegramClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return err
+	}
+	if !reply.OK {
+		return fmt.Errorf("telegram %s failed: %s", method, reply.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(reply.Result, result)
+	}
+	return nil
+}
+
+// Helper function to send a text message to a chat
+func sendTelegramMessage(ctx context.Context, chatID int64, text string) error {
+	body, err := json.Marshal(map[string]interface{}{"chat_id": chatID, "text": text})
+	if err != nil {
+		return err
+	}
+	return telegramCall(ctx, "sendMessage", "application/json", bytes.NewReader(body), nil)
+}
+
+// Helper function to send a PNG image with a caption to a chat
+func sendTelegramPhoto(ctx context.Context, chatID int64, image []byte, caption string) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	form.WriteField("caption", caption)
+	part, err := form.CreateFormFile("photo", "board.png")
+	if err != nil {
+		return err
+	}
+	part.Write(image)
+	form.Close()
+	return telegramCall(ctx, "sendPhoto", form.FormDataContentType(), &body, nil)
+}
+
+// Helper function to find the chat linked to a player
+func findTelegramLink(ctx context.Context, player string) (TelegramLink, error) {
+	var link TelegramLink
+	err := getTelegramLinks().FindOne(ctx, bson.M{"_id": player}).Decode(&link)
+	return link, err
+}
+
+// Helper function to message a player on Telegram in the background, if they have linked a chat
+func messagePlayer(player, text string, image []byte) {
+	if !telegramEnabled() || player == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		link, err := findTelegramLink(ctx, player)
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to look up Telegram link for %s: %v", player, err)
+			return
+		}
+
+		if image != nil {
+			err = sendTelegramPhoto(ctx, link.ChatID, image, text)
+		} else {
+			err = sendTelegramMessage(ctx, link.ChatID, text)
+		}
+		if err != nil {
+			log.Printf("Failed to message %s on Telegram: %v", player, err)
+		}
+	}()
+}
+
+// Helper function to get the player to move in a game
+func playerToMove(game Game) string {
+	if len(game.Moves)%2 == 0 {
+		return game.Player1
+	}
+	return game.Player2
+}
+
+// Helper function to get a player's opponent in a game, empty if they are not playing in it
+func opponentOf(game Game, player string) string {
+	switch player {
+	case game.Player1:
+		return game.Player2
+	case game.Player2:
+		return game.Player1
+	}
+	return ""
+}
+
+// notifyTurn tells the player to move, with the board and a link to the game, that it is their turn
+func notifyTurn(game Game) {
+	player := playerToMove(game)
+	if !telegramEnabled() || player == "" {
+		return
+	}
+
+	last := game.Moves[len(game.Moves)-1]
+	caption := fmt.Sprintf("Your move in %s against %s. They played %s.%s\nGame ID: %s",
+		gameTitle(game), orUnknown(opponentOf(game, player)), last, announcementLink(game.ID), game.ID)
+
+	// Blindfolded players only get the move
+	if boardHiddenFrom(game, player) {
+		messagePlayer(player, caption, nil)
+		return
+	}
+
+	messagePlayer(player, caption, gameBoardPNG(game))
+}
+
+// pollTelegram receives bot commands with long polling until the process exits
+func pollTelegram() {
+	var offset int64
+	for {
+		var updates []telegramUpdate
+		body, _ := json.Marshal(map[string]interface{}{
+			"offset":          offset,
+			"timeout":         int(telegramPollTimeout.Seconds()),
+			"allowed_updates": []string{"message"},
+		})
+		err := telegramCall(context.Background(), "getUpdates", "application/json", bytes.NewReader(body), &updates)
+		if err != nil {
+			log.Printf("Failed to get Telegram updates: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil || !strings.HasPrefix(update.Message.Text, "/") {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			reply := handleTelegramCommand(ctx, update.Message.Chat.ID, update.Message.Text)
+			if err := sendTelegramMessage(ctx, update.Message.Chat.ID, reply); err != nil {
+				log.Printf("Failed to reply on Telegram: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Helper function to run a bot command and return the reply
+func handleTelegramCommand(ctx context.Context, chatID int64, text string) string {
+	fields := strings.Fields(text)
+	// Commands may be addressed to the bot as /command@botname
+	command := strings.SplitN(fields[0], "@", 2)[0]
+	arg := strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+
+	switch command {
+	case "/start", "/help":
+		return telegramHelp
+	case "/link":
+		return linkTelegram(ctx, chatID, arg)
+	case "/unlink":
+		if _, err := getTelegramLinks().DeleteMany(ctx, bson.M{"chatId": chatID}); err != nil {
+			log.Printf("Failed to unlink Telegram chat: %v", err)
+			return "Something went wrong, try again later."
+		}
+		return "You will no longer get notifications here."
+	case "/resign", "/draw":
+		var player TelegramLink
+		if err := getTelegramLinks().FindOne(ctx, bson.M{"chatId": chatID}).Decode(&player); err != nil {
+			return "Link your player first with /link <code>."
+		}
+		game, err := findGame(ctx, arg)
+		if err != nil {
+			return "Game not found."
+		}
+		if opponentOf(game, player.Player) == "" {
+			return "You are not playing in that game."
+		}
+		if game.VoteChessID != "" {
+			return "Vote chess games are played by their teams and can't be resigned or drawn here."
+		}
+		if game.Result != "" {
+			return "That game is already over (" + game.Result + ")."
+		}
+		if command == "/resign" {
+			return resignGame(ctx, game, player.Player)
+		}
+		return offerDraw(ctx, game, player.Player)
+	}
+	return "Unknown command.\n\n" + telegramHelp
+}
+
+// Helper function to link a chat to the player a link code was issued for,
+// replacing any player the chat was linked to before. Codes aren't tied to a
+// login, so a newly redeemed code also replaces the chat the player was linked
+// to, and that chat is told so a player can always take their link back.
+func linkTelegram(ctx context.Context, chatID int64, code string) string {
+	if code == "" {
+		return "Usage: /link <code>"
+	}
+	var issued TelegramCode
+	filter := bson.M{"_id": code, "expiresAt": bson.M{"$gt": time.Now()}}
+	if err := getTelegramCodes().FindOneAndDelete(ctx, filter).Decode(&issued); err != nil {
+		return "That code is invalid or has expired."
+	}
+
+	if _, err := getTelegramLinks().DeleteMany(ctx, bson.M{"chatId": chatID, "_id": bson.M{"$ne": issued.Player}}); err != nil {
+		log.Printf("Failed to unlink Telegram chat: %v", err)
+		return "Something went wrong, try again later."
+	}
+	var previous TelegramLink
+	err := getTelegramLinks().FindOneAndUpdate(ctx,
+		bson.M{"_id": issued.Player},
+		bson.M{"$set": bson.M{"chatId": chatID, "linkedAt": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Failed to link Telegram chat: %v", err)
+		return "Something went wrong, try again later."
+	}
+	if err == nil && previous.ChatID != chatID {
+		notice := "Another chat linked " + issued.Player + " with a new code, so you will no longer get notifications here. " +
+			"If that wasn't you, get a new code and send /link <code> to take it back."
+		if err := sendTelegramMessage(ctx, previous.ChatID, notice); err != nil {
+			log.Printf("Failed to tell Telegram chat it was unlinked: %v", err)
+		}
+	}
+	return "You will get a message here whenever it is " + issued.Player + "'s turn."
+}
+
+// Handler function to issue a one-time code that links a player's Telegram chat
+func createTelegramCode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	if !telegramEnabled() {
+		http.Error(w, "Telegram is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	secret, err := newSecret(5)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	code := TelegramCode{Code: secret, Player: mux.Vars(r)["id"], ExpiresAt: time.Now().Add(telegramCodeLifetime)}
+	if _, err := getTelegramCodes().InsertOne(r.Context(), code); err != nil {
+		http.Error(w, "Failed to store link code", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(code)
+}
+
+// Helper function to resign a game on behalf of a player
+func resignGame(ctx context.Context, game Game, player string) string {
+	result := "0-1"
+	if player == game.Player2 {
+		result = "1-0"
+	}
+	err := setGameFields(ctx, game, bson.M{"result": result, "drawOffer": ""})
+	if err == errGameFinished {
+		return "That game is already over."
+	}
+	if err != nil {
+		log.Printf("Failed to resign game %s: %v", game.ID, err)
+		return "Something went wrong, try again later."
+	}
+	messagePlayer(opponentOf(game, player), player+" resigned "+gameTitle(game)+". You win!", nil)
+	return "You resigned " + gameTitle(game) + "."
+}
+
+// Helper function to offer a draw, or accept the opponent's standing offer
+func offerDraw(ctx context.Context, game Game, player string) string {
+	opponent := opponentOf(game, player)
+
+	if game.DrawOffer == opponent {
+		err := setGameFields(ctx, game, bson.M{"result": "1/2-1/2", "drawOffer": ""})
+		if err == errGameFinished {
+			return "That game is already over."
+		}
+		if err != nil {
+			log.Printf("Failed to draw game %s: %v", game.ID, err)
+			return "Something went wrong, try again later."
+		}
+		messagePlayer(opponent, player+" accepted your draw offer in "+gameTitle(game)+".", nil)
+		return "Draw agreed in " + gameTitle(game) + "."
+	}
+
+	if game.DrawOffer == player {
+		return "You already offered a draw in that game."
+	}
+	if err := setGameFields(ctx, game, bson.M{"drawOffer": player}); err != nil {
+		log.Printf("Failed to offer draw in game %s: %v", game.ID, err)
+		return "Something went wrong, try again later."
+	}
+	messagePlayer(opponent, fmt.Sprintf("%s offers a draw in %s. Reply /draw %s to accept.", player, gameTitle(game), game.ID), nil)
+	return "Draw offered to " + orUnknown(opponent) + "."
+}
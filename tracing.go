@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Name reported for spans created by this service
+const serviceName = "chess-game-api"
+
+// Tracer used for spans that are not covered by the HTTP and MongoDB instrumentation
+var tracer = otel.Tracer(serviceName)
+
+// initTracing exports spans to the OTLP endpoint configured through the
+// standard OTEL_EXPORTER_OTLP_* environment variables. When no endpoint is
+// configured spans are not recorded. The returned function flushes pending
+// spans on shutdown.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	// Propagate trace context to and from clients and downstream services
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", getenv("OTEL_SERVICE_NAME", serviceName)),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	log.Println("Exporting traces over OTLP")
+	return provider.Shutdown, nil
+}
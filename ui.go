@@ -0,0 +1,22 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+)
+
+// Web UI for creating, playing and watching games
+//
+//go:embed static
+var staticFiles embed.FS
+
+// Helper function to serve the embedded web UI
+func uiHandler() http.Handler {
+	files, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return http.FileServer(http.FS(files))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Prefix under which the current version of the API is served
+const apiV1Prefix = "/api/v1"
+
+// Helper function to register the endpoints that were served before /api/v1,
+// which the unversioned paths keep serving
+func registerLegacyRoutes(router *mux.Router) {
+	// router.HandleFunc("/games", getGames).Methods("GET")
+	router.HandleFunc("/games", createGame).Methods("POST")
+	router.HandleFunc("/games/{id}", getGame).Methods("GET")
+	router.HandleFunc("/games/{id}", updateGame).Methods("PUT")
+	router.HandleFunc("/games/{id}", deleteGame).Methods("DELETE")
+	router.HandleFunc("/tablebase", getTablebase).Methods("GET")
+}
+
+// Helper function to register the API endpoints on a router. Endpoints added
+// since /api/v1 go here only, not in registerLegacyRoutes.
+func registerRoutes(router *mux.Router) {
+	registerLegacyRoutes(router)
+	router.HandleFunc("/games/{id}/ws", watchGame).Methods("GET")
+	router.HandleFunc("/games/{id}/og", getGameOpenGraph).Methods("GET")
+	router.HandleFunc("/games/{id}/image.png", getGameImage).Methods("GET")
+	router.HandleFunc("/games/{id}/hint", getGameHint).Methods("GET")
+	router.HandleFunc("/games/{id}/reveal", revealGame).Methods("GET")
+	router.HandleFunc("/games/{id}/fork", forkGame).Methods("POST")
+	router.HandleFunc("/simuls", createSimul).Methods("POST")
+	router.HandleFunc("/simuls/{id}", getSimul).Methods("GET")
+	router.HandleFunc("/simuls/{id}/ws", watchSimul).Methods("GET")
+	router.HandleFunc("/arenas", createArena).Methods("POST")
+	router.HandleFunc("/arenas/{id}", getArena).Methods("GET")
+	router.HandleFunc("/arenas/{id}/join", joinArena).Methods("POST")
+	router.HandleFunc("/arenas/{id}/withdraw", withdrawArena).Methods("POST")
+	router.HandleFunc("/arenas/{id}/ws", watchArena).Methods("GET")
+	router.HandleFunc("/votechess", createVoteChess).Methods("POST")
+	router.HandleFunc("/votechess/{id}", getVoteChessGame).Methods("GET")
+	router.HandleFunc("/votechess/{id}/join", joinVoteChess).Methods("POST")
+	router.HandleFunc("/votechess/{id}/vote", voteMove).Methods("POST")
+	router.HandleFunc("/votechess/{id}/ws", watchVoteChess).Methods("GET")
+	router.HandleFunc("/players/{id}", getPlayer).Methods("GET")
+	router.HandleFunc("/players/{id}/achievements", getPlayerAchievements).Methods("GET")
+	router.HandleFunc("/players/{id}/telegram-code", createTelegramCode).Methods("POST")
+	router.HandleFunc("/leaderboard", getLeaderboard).Methods("GET")
+}
+
+// Helper function to get the sunset date of the unversioned paths, if one is configured
+func legacySunset() (time.Time, bool) {
+	value := os.Getenv("LEGACY_API_SUNSET")
+	if value == "" {
+		return time.Time{}, false
+	}
+	sunset, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		log.Printf("Ignoring invalid LEGACY_API_SUNSET %q: %v", value, err)
+		return time.Time{}, false
+	}
+	return sunset, true
+}
+
+// deprecated marks responses from the unversioned paths as deprecated and
+// points clients at the equivalent /api/v1 path
+func deprecated(next http.Handler) http.Handler {
+	sunset, hasSunset := legacySunset()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if hasSunset {
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Set("Link", "<"+apiV1Prefix+r.URL.Path+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
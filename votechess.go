@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// How often vote chess games are checked for a voting window that has closed
+const voteChessInterval = time.Second
+
+// Allowed length of the voting window for each move, in seconds
+const (
+	defaultVoteWindow = 60
+	minVoteWindow     = 10
+	maxVoteWindow     = 24 * 60 * 60
+)
+
+// Longest team chat message, in characters
+const maxChatLength = 500
+
+// Sides a vote chess team can play
+const (
+	sideWhite = "white"
+	sideBlack = "black"
+)
+
+// VoteChess is a game between two teams, where each team's move is the one
+// most of its members voted for before the voting window closed
+type VoteChess struct {
+	ID            string            `json:"id,omitempty" bson:"_id,omitempty"`
+	GameID        string            `json:"gameId" bson:"gameId"`
+	White         []string          `json:"white" bson:"white"`
+	Black         []string          `json:"black" bson:"black"`
+	WindowSeconds int               `json:"windowSeconds" bson:"windowSeconds"`
+	Ply           int               `json:"ply" bson:"ply"`
+	Deadline      time.Time         `json:"deadline" bson:"deadline"`
+	Votes         []Vote            `json:"-" bson:"votes"`
+	Tokens        map[string]string `json:"-" bson:"tokens"` // Team member by secret token
+	Finished      bool              `json:"finished,omitempty" bson:"finished,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+}
+
+// Vote is a team member's choice for the move being decided
+type Vote struct {
+	Player  string    `json:"player" bson:"player"`
+	Move    string    `json:"move" bson:"move"`
+	VotedAt time.Time `json:"votedAt" bson:"votedAt"`
+}
+
+// VoteTally is the number of votes a move has received
+type VoteTally struct {
+	Move  string `json:"move"`
+	Votes int    `json:"votes"`
+}
+
+// VoteChessView is a vote chess game as shown to a team. The tally is only
+// included for the team whose move is being decided.
+type VoteChessView struct {
+	VoteChess
+	SideToMove string      `json:"sideToMove"`
+	VotesCast  int         `json:"votesCast"`
+	Tally      []VoteTally `json:"tally,omitempty"`
+}
+
+// VoteChessMember is a team view along with the secret token a member uses to
+// vote and to join their team's socket. Tokens are only returned when issued.
+type VoteChessMember struct {
+	VoteChessView
+	Token string `json:"token"`
+}
+
+// ChatMessage is a message sent to a player's own team
+type ChatMessage struct {
+	Player string    `json:"player"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sentAt"`
+}
+
+// Serialises changes to vote chess games, which are read, changed and written back whole
+var voteChessMu sync.Mutex
+
+// Helper function to get the MongoDB collection of vote chess games
+func getVoteChess() *mongo.Collection {
+	return client.Database("chess").Collection("votechess")
+}
+
+// Helper function to get the topic on which a team's votes and chat are broadcast
+func teamTopic(id, side string) string {
+	return "votechess:" + id + ":" + side
+}
+
+// Helper function to find a vote chess game by its hex ID
+func findVoteChess(ctx context.Context, hexId string) (VoteChess, error) {
+	var vc VoteChess
+	id, err := primitive.ObjectIDFromHex(hexId)
+	if err != nil {
+		return vc, err
+	}
+	err = getVoteChess().FindOne(ctx, bson.M{"_id": id}).Decode(&vc)
+	return vc, err
+}
+
+// Helper function to store a vote chess game's teams, votes and voting window
+func saveVoteChess(ctx context.Context, vc VoteChess) error {
+	id, err := primitive.ObjectIDFromHex(vc.ID)
+	if err != nil {
+		return err
+	}
+	_, err = getVoteChess().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"white":    vc.White,
+		"black":    vc.Black,
+		"ply":      vc.Ply,
+		"deadline": vc.Deadline,
+		"votes":    vc.Votes,
+		"tokens":   vc.Tokens,
+		"finished": vc.Finished,
+	}})
+	return err
+}
+
+// Helper function to get the side a player is on, empty if they are on neither team
+func teamOf(vc VoteChess, player string) string {
+	for _, member := range vc.White {
+		if member == player {
+			return sideWhite
+		}
+	}
+	for _, member := range vc.Black {
+		if member == player {
+			return sideBlack
+		}
+	}
+	return ""
+}
+
+// Helper function to add a player to a team, returning the token they use to act as a member
+func addTeamMember(vc *VoteChess, player, side string) (string, error) {
+	token, err := newSecret(16)
+	if err != nil {
+		return "", err
+	}
+	if side == sideWhite {
+		vc.White = append(vc.White, player)
+	} else {
+		vc.Black = append(vc.Black, player)
+	}
+	vc.Tokens[token] = player
+	return token, nil
+}
+
+// Helper function to get the team member a token was issued to, and their side
+func memberOf(vc VoteChess, token string) (player, side string) {
+	player, ok := vc.Tokens[token]
+	if token == "" || !ok {
+		return "", ""
+	}
+	return player, teamOf(vc, player)
+}
+
+// Helper function to get the side whose move is being decided
+func sideToMove(vc VoteChess) string {
+	if vc.Ply%2 == 0 {
+		return sideWhite
+	}
+	return sideBlack
+}
+
+// Helper function to count the votes for each move, most voted first. Ties
+// go to the move that was voted for first.
+func tallyVotes(votes []Vote) []VoteTally {
+	var tally []VoteTally
+	index := make(map[string]int)
+	first := make(map[string]time.Time)
+	for _, vote := range votes {
+		i, ok := index[vote.Move]
+		if !ok {
+			i = len(tally)
+			index[vote.Move] = i
+			tally = append(tally, VoteTally{Move: vote.Move})
+		}
+		tally[i].Votes++
+		if t, ok := first[vote.Move]; !ok || vote.VotedAt.Before(t) {
+			first[vote.Move] = vote.VotedAt
+		}
+	}
+	sort.SliceStable(tally, func(i, j int) bool {
+		if tally[i].Votes != tally[j].Votes {
+			return tally[i].Votes > tally[j].Votes
+		}
+		return first[tally[i].Move].Before(first[tally[j].Move])
+	})
+	return tally
+}
+
+// Helper function to build the view of a vote chess game for one side, or for
+// outsiders if side is empty
+func voteChessView(vc VoteChess, side string) VoteChessView {
+	view := VoteChessView{VoteChess: vc, SideToMove: sideToMove(vc), VotesCast: len(vc.Votes)}
+	if side != "" && side == view.SideToMove {
+		view.Tally = tallyVotes(vc.Votes)
+	}
+	return view
+}
+
+// Helper function to push the latest state of a vote chess game to both teams
+func publishVoteChess(ctx context.Context, vc VoteChess) {
+	for _, side := range []string{sideWhite, sideBlack} {
+		broadcast(ctx, teamTopic(vc.ID, side), Message{Type: "votechess", Data: voteChessView(vc, side)})
+	}
+}
+
+// Helper function to normalise a move to coordinate notation, so votes for
+// "e2-e4" and "e2e4" are counted together
+func normaliseMove(move string) (string, bool) {
+	from, to, promotion, err := parseMove(move)
+	if err != nil {
+		return "", false
+	}
+	normalised := squareName(from) + squareName(to)
+	if promotion != 0 {
+		normalised += string(promotion)
+	}
+	return normalised, true
+}
+
+// Handler function to create a vote chess game between two teams
+func createVoteChess(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	var req struct {
+		Name          string   `json:"name"`
+		White         []string `json:"white"`
+		Black         []string `json:"black"`
+		WindowSeconds int      `json:"windowSeconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if req.WindowSeconds == 0 {
+		req.WindowSeconds = defaultVoteWindow
+	}
+	if req.WindowSeconds < minVoteWindow || req.WindowSeconds > maxVoteWindow {
+		http.Error(w, "Invalid voting window", http.StatusBadRequest)
+		return
+	}
+
+	vc := VoteChess{
+		White:         []string{},
+		Black:         []string{},
+		Tokens:        make(map[string]string),
+		WindowSeconds: req.WindowSeconds,
+		CreatedAt:     time.Now(),
+	}
+	// Initial members get their tokens through the creator, who passes them on
+	tokens := make(map[string]string)
+	for _, team := range []struct {
+		side    string
+		players []string
+	}{{sideWhite, req.White}, {sideBlack, req.Black}} {
+		side := team.side
+		for _, player := range team.players {
+			if player == "" || teamOf(vc, player) != "" {
+				continue
+			}
+			token, err := addTeamMember(&vc, player, side)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			tokens[player] = token
+		}
+	}
+
+	game := Game{GameName: req.Name, Player1: "White team", Player2: "Black team"}
+	if err := insertGame(r.Context(), &game); err != nil {
+		http.Error(w, "Failed to insert game into database", http.StatusInternalServerError)
+		return
+	}
+	vc.GameID = game.ID
+	vc.Deadline = time.Now().Add(time.Duration(vc.WindowSeconds) * time.Second)
+
+	result, err := getVoteChess().InsertOne(r.Context(), vc)
+	if err != nil {
+		http.Error(w, "Failed to insert vote chess game into database", http.StatusInternalServerError)
+		return
+	}
+	vc.ID = result.InsertedID.(primitive.ObjectID).Hex()
+
+	// Link the game back so moves can't be played around the vote
+	if err := setGameFields(r.Context(), game, bson.M{"voteChessId": vc.ID}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		VoteChessView
+		Tokens map[string]string `json:"tokens"`
+	}{voteChessView(vc, ""), tokens})
+}
+
+// Handler function to get a vote chess game, without either team's votes
+func getVoteChessGame(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	vc, err := findVoteChess(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Vote chess game not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(voteChessView(vc, ""))
+}
+
+// Handler function to join one of the teams of a vote chess game
+func joinVoteChess(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	var req struct {
+		Player string `json:"player"`
+		Side   string `json:"side"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Player == "" {
+		http.Error(w, "Missing player", http.StatusBadRequest)
+		return
+	}
+	if req.Side != sideWhite && req.Side != sideBlack {
+		http.Error(w, "Side must be white or black", http.StatusBadRequest)
+		return
+	}
+
+	voteChessMu.Lock()
+	defer voteChessMu.Unlock()
+
+	vc, err := findVoteChess(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Vote chess game not found", http.StatusNotFound)
+		return
+	}
+	if vc.Finished {
+		http.Error(w, "Game is over", http.StatusConflict)
+		return
+	}
+
+	// A token is only handed out once, so a name that has joined can't be joined again
+	if teamOf(vc, req.Player) != "" {
+		http.Error(w, "Player has already joined", http.StatusConflict)
+		return
+	}
+	if vc.Tokens == nil {
+		vc.Tokens = make(map[string]string)
+	}
+	token, err := addTeamMember(&vc, req.Player, req.Side)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := saveVoteChess(r.Context(), vc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	publishVoteChess(r.Context(), vc)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(VoteChessMember{VoteChessView: voteChessView(vc, req.Side), Token: token})
+}
+
+// Handler function to vote for the move a team plays next, as the member a
+// token was issued to. A player's later vote replaces their earlier one.
+func voteMove(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	var req struct {
+		Token string `json:"token"`
+		Move  string `json:"move"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Missing token", http.StatusBadRequest)
+		return
+	}
+	move, ok := normaliseMove(req.Move)
+	if !ok {
+		http.Error(w, "Invalid move", http.StatusBadRequest)
+		return
+	}
+
+	voteChessMu.Lock()
+	defer voteChessMu.Unlock()
+
+	vc, err := findVoteChess(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Vote chess game not found", http.StatusNotFound)
+		return
+	}
+	if vc.Finished {
+		http.Error(w, "Game is over", http.StatusConflict)
+		return
+	}
+	player, side := memberOf(vc, req.Token)
+	if side == "" {
+		http.Error(w, "Invalid token", http.StatusForbidden)
+		return
+	}
+	if side != sideToMove(vc) {
+		http.Error(w, "It is not your team's move", http.StatusConflict)
+		return
+	}
+
+	// Votes are checked against the current position as far as the board
+	// checks moves: the piece must belong to the side to move and must not
+	// capture its own side's piece. Whether the piece can move that way, or
+	// leaves its king in check, isn't checked.
+	game, err := findGame(r.Context(), vc.GameID)
+	if err != nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if game.Result != "" {
+		http.Error(w, "Game is over", http.StatusConflict)
+		return
+	}
+	board, err := replayMoves(game.Moves)
+	if err != nil {
+		http.Error(w, "Cannot replay game: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := board.applyMove(move); err != nil {
+		http.Error(w, "Invalid move: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	votes := make([]Vote, 0, len(vc.Votes)+1)
+	for _, vote := range vc.Votes {
+		if vote.Player != player {
+			votes = append(votes, vote)
+		}
+	}
+	vc.Votes = append(votes, Vote{Player: player, Move: move, VotedAt: time.Now()})
+	if err := saveVoteChess(r.Context(), vc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	publishVoteChess(r.Context(), vc)
+	json.NewEncoder(w).Encode(voteChessView(vc, side))
+}
+
+// Handler function for a team's live view of a vote chess game over a
+// WebSocket, given a member's token in the query string. Chat messages sent on
+// the socket only reach the member's own team.
+func watchVoteChess(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+	id := mux.Vars(r)["id"]
+
+	vc, err := findVoteChess(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Vote chess game not found", http.StatusNotFound)
+		return
+	}
+	player, side := memberOf(vc, r.URL.Query().Get("token"))
+	if side == "" {
+		http.Error(w, "Invalid token", http.StatusForbidden)
+		return
+	}
+
+	topic := teamTopic(id, side)
+	subscribe(w, r, topic, &Message{Type: "votechess", Data: voteChessView(vc, side)}, func(ctx context.Context, msg Message) {
+		text, ok := msg.Data.(string)
+		if msg.Type != "chat" || !ok {
+			return
+		}
+		text = strings.TrimSpace(text)
+		if text == "" || utf8.RuneCountInString(text) > maxChatLength {
+			return
+		}
+		broadcast(ctx, topic, Message{Type: "chat", Data: ChatMessage{Player: player, Text: text, SentAt: time.Now()}})
+	})
+}
+
+// playVotedMove plays the winning move of a closed voting window and opens
+// the next one. If nobody voted, the window is extended.
+func playVotedMove(ctx context.Context, vc VoteChess) error {
+	game, err := findGame(ctx, vc.GameID)
+	if err != nil {
+		return err
+	}
+	if game.Result != "" {
+		vc.Finished = true
+		return saveVoteChess(ctx, vc)
+	}
+
+	window := time.Duration(vc.WindowSeconds) * time.Second
+	tally := tallyVotes(vc.Votes)
+	if len(tally) == 0 {
+		vc.Deadline = time.Now().Add(window)
+		return saveVoteChess(ctx, vc)
+	}
+
+	moves := append(append([]string{}, game.Moves...), tally[0].Move)
+	if err := setGameFields(ctx, game, bson.M{"moves": moves}); err != nil {
+		return err
+	}
+	log.Printf("Vote chess %s: %s plays %s with %d votes", vc.ID, sideToMove(vc), tally[0].Move, tally[0].Votes)
+
+	vc.Ply++
+	vc.Votes = []Vote{}
+	vc.Deadline = time.Now().Add(window)
+	if err := saveVoteChess(ctx, vc); err != nil {
+		return err
+	}
+	publishVoteChess(ctx, vc)
+	return nil
+}
+
+// runVoteChess plays the winning move of every vote chess game whose voting window has closed
+func runVoteChess() {
+	ticker := time.NewTicker(voteChessInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		filter := bson.M{"finished": bson.M{"$ne": true}, "deadline": bson.M{"$lte": time.Now()}}
+		cursor, err := getVoteChess().Find(ctx, filter)
+		if err != nil {
+			log.Printf("Failed to find vote chess games: %v", err)
+			cancel()
+			continue
+		}
+		var games []VoteChess
+		if err := cursor.All(ctx, &games); err != nil {
+			log.Printf("Failed to load vote chess games: %v", err)
+		}
+
+		for _, vc := range games {
+			voteChessMu.Lock()
+			// Reload under the lock, a vote may have come in since the query
+			if current, err := findVoteChess(ctx, vc.ID); err == nil && !current.Finished && !time.Now().Before(current.Deadline) {
+				if err := playVotedMove(ctx, current); err != nil {
+					log.Printf("Failed to play vote chess move %s: %v", vc.ID, err)
+				}
+			}
+			voteChessMu.Unlock()
+		}
+		cancel()
+	}
+}
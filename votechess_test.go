@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTallyVotes(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	vote := func(player, move string, seconds int) Vote {
+		return Vote{Player: player, Move: move, VotedAt: start.Add(time.Duration(seconds) * time.Second)}
+	}
+
+	tests := []struct {
+		name  string
+		votes []Vote
+		want  []VoteTally
+	}{
+		{
+			name:  "no votes",
+			votes: nil,
+			want:  nil,
+		},
+		{
+			name:  "most voted first",
+			votes: []Vote{vote("a", "e2e4", 1), vote("b", "d2d4", 2), vote("c", "d2d4", 3)},
+			want:  []VoteTally{{Move: "d2d4", Votes: 2}, {Move: "e2e4", Votes: 1}},
+		},
+		{
+			name:  "ties go to the move voted for first",
+			votes: []Vote{vote("a", "g1f3", 1), vote("b", "e2e4", 2), vote("c", "e2e4", 3), vote("d", "g1f3", 4)},
+			want:  []VoteTally{{Move: "g1f3", Votes: 2}, {Move: "e2e4", Votes: 2}},
+		},
+		{
+			name:  "ties use the earliest vote, not the order stored",
+			votes: []Vote{vote("a", "e2e4", 5), vote("b", "d2d4", 2)},
+			want:  []VoteTally{{Move: "d2d4", Votes: 1}, {Move: "e2e4", Votes: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tallyVotes(tt.votes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tallyVotes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}